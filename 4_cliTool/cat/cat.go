@@ -0,0 +1,437 @@
+// Package cat はQ1のcatコマンドの本体。
+// ファイルを与えられた順に連結して出力する。
+package cat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// Stdin はファイル名に "-" が渡されたときに読み込む入力。
+const Stdin = "-"
+
+// DefaultSeparator は行番号と行の間に置く文字列のデフォルト値。
+const DefaultSeparator = ": "
+
+// Options は出力方法の設定。
+type Options struct {
+	Number         bool   // 全ての行に行番号を付ける (-n)
+	NumberNonBlank bool   // 空行以外に行番号を付ける。Numberより優先される (-b)
+	NumberWidth    int    // 行番号の最小幅。右詰めで表示する
+	Separator      string // 行番号と行の区切り。空ならDefaultSeparator
+
+	SqueezeBlank    bool // 連続する空行を1行にまとめる (-s)
+	ShowEnds        bool // 行末に $ を表示する (-E)
+	ShowTabs        bool // タブを ^I で表示する (-T)
+	ShowNonprinting bool // 制御文字を ^ と M- 記法で表示する (-v)
+
+	Decompress Compression // 圧縮された入力を展開する (-z)
+
+	// 入力の文字コード。指定するとUTF-8に変換してから出力する。
+	// AutoEncodingなら推測し、空なら変換しない (--from-encoding)
+	Encoding string
+
+	// 最後のファイルを出力した後も、追記された内容を出力し続ける (-f)。
+	// 追記された内容は圧縮の展開と文字コードの変換をせずに出力する。
+	Follow bool
+	// Followで追記を確認する間隔。0ならDefaultPollInterval
+	PollInterval time.Duration
+
+	// 出力する行 (--lines, --head, --tail, --global)
+	Select Selection
+
+	// ディレクトリの下のファイルを名前順に全て出力する (-r)
+	Recursive bool
+	// Recursiveでたどるファイル名のパターン。filepath.Matchの形式 (--include, --exclude)
+	Include, Exclude []string
+	// 各ファイルの前に "==> path <==" を表示する (-headers)
+	Headers bool
+
+	// nilでなければ、ファイルの読み込みに失敗したときにすぐ呼ぶ。
+	// エラーの表示を出力の途中の、失敗した位置に出すために使う
+	OnError func(err *FileError)
+}
+
+// transforms は出力を変換するオプションが指定されているかを返す。
+func (opts Options) transforms() bool {
+	return opts.Number || opts.NumberNonBlank || opts.SqueezeBlank ||
+		opts.ShowEnds || opts.ShowTabs || opts.ShowNonprinting ||
+		opts.Select.active()
+}
+
+// ShowAll は -A と同じく -vET を設定する。
+func (opts *Options) ShowAll() {
+	opts.ShowNonprinting = true
+	opts.ShowEnds = true
+	opts.ShowTabs = true
+}
+
+// printer は複数ファイルにまたがる状態を持つ。
+// 行番号は全てのファイルで通し番号にする。
+type printer struct {
+	w     io.Writer
+	out   io.Writer // Concatに渡されたw。Followで書き出すたびにFlushする
+	opts  Options
+	line  int
+	blank bool   // 直前の行が空行だったか
+	buf   []byte // 変換後の行
+	br    *bufio.Reader
+
+	enc encoding.Encoding // 入力の文字コード。nilなら推測する
+
+	midLine   bool // 行の途中まで書き出している
+	pendingCR bool // 行末かもしれないCRを保留している
+
+	pos      int      // Selectionで使う行の位置
+	skipping bool     // 今の行を出力しない
+	tail     [][]byte // Selection.Tailのためのリングバッファ
+	tailHead int      // tailの一番古い行
+	partial  []byte   // tailに入れる途中の行
+}
+
+// Concat は files を与えられた順に読み込み、w に書き出す。
+// files が空の場合や "-" の場合は標準入力を読み込む。
+//
+// 読み込めないファイルがあっても残りのファイルは処理を続け、
+// 失敗したファイルのエラーをErrorsにまとめて返す。
+// w への書き込みに失敗した場合はその時点で終了し、そのエラーを返す。
+func Concat(w io.Writer, opts Options, files ...string) error {
+	return ConcatContext(context.Background(), w, opts, files...)
+}
+
+// ConcatContext はConcatと同じだが、ctx が終わると処理をやめる。
+// Followを指定した場合は ctx が終わるまで返らない。
+func ConcatContext(ctx context.Context, w io.Writer, opts Options, files ...string) error {
+	if len(files) == 0 {
+		files = []string{Stdin}
+	}
+	if opts.Separator == "" {
+		opts.Separator = DefaultSeparator
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	ew := &errWriter{w: w}
+	p := &printer{w: ew, out: w, opts: opts}
+	if opts.Encoding != "" && opts.Encoding != AutoEncoding {
+		enc, err := lookupEncoding(opts.Encoding)
+		if err != nil {
+			return err
+		}
+		p.enc = enc
+	}
+
+	if err := ValidatePatterns(opts.Include); err != nil {
+		return err
+	}
+	if err := ValidatePatterns(opts.Exclude); err != nil {
+		return err
+	}
+
+	var errs Errors
+	fail := func(err *FileError) {
+		errs = append(errs, err)
+		if opts.OnError != nil {
+			opts.OnError(err)
+		}
+	}
+	if opts.Recursive {
+		var walkErrs Errors
+		files, walkErrs = expand(files, opts.Include, opts.Exclude)
+		for _, err := range walkErrs {
+			fail(err)
+		}
+	}
+
+	for i, fn := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// for内でdeferを避けるので関数に分ける
+		if opts.Headers {
+			p.header(fn, i == 0)
+		}
+		follow := opts.Follow && i == len(files)-1
+		err := p.catFile(ctx, fn, follow)
+		if ew.err != nil {
+			return ew.err
+		}
+		if err == errStop {
+			if opts.Select.Global {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			fail(newFileError(fn, err))
+		}
+	}
+
+	// 全体の最後の行は全てのファイルを読み終えてから出力する
+	if opts.Select.Global {
+		if err := p.flushTail(); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// header はheadやtailと同じ形式でファイル名を表示する。
+// 書き込みのエラーはerrWriterが覚えている。
+func (p *printer) header(fn string, first bool) {
+	if fn == Stdin {
+		fn = "standard input"
+	}
+	if !first {
+		io.WriteString(p.w, "\n")
+	}
+	fmt.Fprintf(p.w, "==> %s <==\n", fn)
+}
+
+// catFile はファイルを出力する。
+// follow がtrueなら、その後 ctx が終わるまで追記を出力し続ける。
+// 標準入力は追記を待たない。
+func (p *printer) catFile(ctx context.Context, fn string, follow bool) error {
+	if !p.opts.Select.Global {
+		p.pos = 0
+	}
+	if fn == Stdin {
+		return p.catReader(os.Stdin)
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+
+	if err := p.catReader(f); err != nil || !follow {
+		// 読み込み用なのでCloseのエラーは無視する
+		f.Close()
+		return err
+	}
+
+	// 追記された行は全て出力する
+	if err := p.flushTail(); err != nil {
+		f.Close()
+		return err
+	}
+	p.opts.Select.Tail = 0
+	return p.follow(ctx, fn, f)
+}
+
+// catReader はSelection.Tailに合わせて r の読み方を選ぶ。
+func (p *printer) catReader(r io.Reader) error {
+	sel := p.opts.Select
+	if sel.Tail == 0 || sel.Global {
+		return p.copyFile(r)
+	}
+	if f, ok := r.(*os.File); ok && p.seekable(f) {
+		return p.seekTail(f)
+	}
+	if err := p.copyFile(r); err != nil {
+		return err
+	}
+	return p.flushTail()
+}
+
+// copyFile は必要なら圧縮の展開とUTF-8への変換をしてから出力する。
+func (p *printer) copyFile(r io.Reader) error {
+	r, err := decompress(r, p.opts.Decompress)
+	if err != nil {
+		return err
+	}
+	if p.opts.Encoding != "" {
+		r = toUTF8(r, p.enc)
+	}
+	return p.copyLines(r)
+}
+
+func (p *printer) copyLines(r io.Reader) error {
+	// 変換がなければそのままコピーする
+	if !p.opts.transforms() {
+		_, err := io.Copy(p.w, r)
+		return err
+	}
+
+	// 最後の行はファイルを読み終えるまでわからないので溜めておく
+	if p.opts.Select.Tail > 0 {
+		return p.readChunks(r, p.collectChunk)
+	}
+	if err := p.readChunks(r, p.writeChunk); err != nil {
+		return err
+	}
+	return p.flushCR()
+}
+
+// readChunks は r を行ごとに読み込み、handle に渡す。
+// ReadSliceはバッファより長い行を分割して返すので、
+// 行の長さに上限はない。
+func (p *printer) readChunks(r io.Reader, handle func(chunk []byte) error) error {
+	if p.br == nil {
+		p.br = bufio.NewReader(r)
+	} else {
+		p.br.Reset(r)
+	}
+
+	for {
+		chunk, err := p.br.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if herr := handle(chunk); herr != nil {
+				return herr
+			}
+		}
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// writeChunk は行の全部または一部を変換して書き出す。
+// 改行文字はそのまま残し、最後の行に改行がなければ追加しない。
+func (p *printer) writeChunk(chunk []byte) error {
+	eol := chunk[len(chunk)-1] == '\n'
+	body := chunk
+	if eol {
+		body = body[:len(body)-1]
+	}
+
+	if !p.midLine {
+		p.pos++
+		p.skipping = !p.opts.Select.contains(p.pos)
+		if p.skipping {
+			if to := p.opts.Select.To; to > 0 && p.pos > to {
+				return p.stop(eol && len(body) == 0, eol)
+			}
+			p.skip(eol && len(body) == 0)
+		}
+	}
+	if p.skipping {
+		p.midLine = !eol
+		return nil
+	}
+
+	p.buf = p.buf[:0]
+	if !p.midLine {
+		blank := eol && len(body) == 0
+		if blank && p.blank && p.opts.SqueezeBlank {
+			return nil
+		}
+		p.blank = blank
+
+		if p.numbered(blank) {
+			p.line++
+			p.buf = fmt.Appendf(p.buf, "%*d%s", p.opts.NumberWidth, p.line, p.opts.Separator)
+		}
+	}
+	p.midLine = !eol
+
+	// GNU catと同じく、-E ではCRLFのCRを ^M で表示する。
+	// CRとLFが別のchunkに分かれることがあるので、行末のCRは次のchunkまで保留する。
+	cr := false
+	if p.opts.ShowEnds {
+		if p.pendingCR && eol && len(body) == 0 {
+			cr, p.pendingCR = true, false
+		} else if eol && len(body) > 0 && body[len(body)-1] == '\r' {
+			cr, body = true, body[:len(body)-1]
+		}
+	}
+	if p.pendingCR {
+		p.buf = p.appendLine(p.buf, []byte{'\r'})
+		p.pendingCR = false
+	}
+	if p.opts.ShowEnds && !eol && body[len(body)-1] == '\r' {
+		body, p.pendingCR = body[:len(body)-1], true
+	}
+
+	p.buf = p.appendLine(p.buf, body)
+	if cr {
+		p.buf = append(p.buf, '^', 'M')
+	}
+	if eol {
+		if p.opts.ShowEnds {
+			p.buf = append(p.buf, '$')
+		}
+		p.buf = append(p.buf, '\n')
+	}
+
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+// flushCR は保留していたCRを書き出す。
+func (p *printer) flushCR() error {
+	if !p.pendingCR {
+		return nil
+	}
+	p.pendingCR = false
+	_, err := p.w.Write(p.appendLine(p.buf[:0], []byte{'\r'}))
+	return err
+}
+
+// numbered は行に行番号を付けるかどうかを返す。
+func (p *printer) numbered(blank bool) bool {
+	if p.opts.NumberNonBlank {
+		return !blank
+	}
+	return p.opts.Number
+}
+
+// appendLine は -T と -v の変換をしながら line を buf に追加する。
+// 表記はGNU catに合わせている。
+func (p *printer) appendLine(buf, line []byte) []byte {
+	if !p.opts.ShowTabs && !p.opts.ShowNonprinting {
+		return append(buf, line...)
+	}
+
+	for _, c := range line {
+		switch {
+		case c == '\t':
+			if p.opts.ShowTabs {
+				buf = append(buf, '^', 'I')
+			} else {
+				buf = append(buf, c)
+			}
+		case !p.opts.ShowNonprinting:
+			buf = append(buf, c)
+		default:
+			buf = appendNonprinting(buf, c)
+		}
+	}
+	return buf
+}
+
+// appendNonprinting は c を ^ と M- 記法で buf に追加する。
+//
+//	0x00-0x1f -> ^@ ... ^_
+//	0x7f      -> ^?
+//	0x80-0xff -> M- に続けて c-0x80 を同じ規則で表示
+func appendNonprinting(buf []byte, c byte) []byte {
+	if c >= 0x80 {
+		buf = append(buf, 'M', '-')
+		c -= 0x80
+	}
+	switch {
+	case c < 0x20:
+		return append(buf, '^', c+0x40)
+	case c == 0x7f:
+		return append(buf, '^', '?')
+	default:
+		return append(buf, c)
+	}
+}
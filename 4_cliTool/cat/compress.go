@@ -0,0 +1,114 @@
+package cat
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Compression は入力の圧縮形式。
+type Compression int
+
+const (
+	NoCompression Compression = iota // 圧縮を解除しない
+	Auto                             // 先頭のマジックバイトで判定する
+	Gzip
+	Bzip2
+	Zlib
+)
+
+var compressionNames = [...]string{
+	NoCompression: "none",
+	Auto:          "auto",
+	Gzip:          "gzip",
+	Bzip2:         "bzip2",
+	Zlib:          "zlib",
+}
+
+func (c Compression) String() string {
+	if c < 0 || int(c) >= len(compressionNames) {
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+	return compressionNames[c]
+}
+
+// MarshalText はflag.TextVarで使うために実装している。
+func (c Compression) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText は "none", "auto", "gzip", "bzip2", "zlib" を受け付ける。
+func (c *Compression) UnmarshalText(text []byte) error {
+	for i, name := range compressionNames {
+		if string(text) == name {
+			*c = Compression(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown compression %q", text)
+}
+
+// decompress は c に従って r を展開するReaderを返す。
+func decompress(r io.Reader, c Compression) (io.Reader, error) {
+	if c == Auto {
+		br := bufio.NewReader(r)
+		c = detect(br)
+		r = br
+	}
+
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Bzip2:
+		return bzip2.NewReader(r), nil
+	case Zlib:
+		return zlib.NewReader(r)
+	default:
+		return r, nil
+	}
+}
+
+// detect は先頭のマジックバイトから圧縮形式を判定する。
+// どれにも当てはまらなければNoCompressionを返す。
+func detect(br *bufio.Reader) Compression {
+	// 読めた分だけで判定するのでエラーは無視する
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return Gzip
+	case len(magic) == 4 && bytes.HasPrefix(magic, []byte("BZh")) && '1' <= magic[3] && magic[3] <= '9':
+		return Bzip2
+	case len(magic) >= 2 && isZlibHeader(magic[0], magic[1]) && inflates(br):
+		return Zlib
+	}
+	return NoCompression
+}
+
+// inflates はバッファに読める分をzlibとして展開できるかを返す。
+// zlibのヘッダは2バイトしかなく、"x^" や "HK" で始まるテキストも当てはまるので、
+// 中身まで確かめる。バッファで途切れているだけなら展開できるとみなす。
+func inflates(br *bufio.Reader) bool {
+	// 読めた分だけで判定するのでエラーは無視する
+	buf, _ := br.Peek(br.Size())
+	zr, err := zlib.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, zr)
+	return err == nil || err == io.ErrUnexpectedEOF
+}
+
+// isZlibHeader はRFC 1950のCMFとFLGとして正しいかを返す。
+// テキストの先頭と区別しにくいので、辞書を使うもの(FDICT)は対象外にする。
+func isZlibHeader(cmf, flg byte) bool {
+	const (
+		deflate = 8
+		fdict   = 0x20
+	)
+	return cmf&0x0f == deflate && cmf>>4 <= 7 &&
+		flg&fdict == 0 && (uint(cmf)<<8|uint(flg))%31 == 0
+}
@@ -0,0 +1,34 @@
+package cat
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"strings"
+	"testing"
+)
+
+func TestDetectZlib(t *testing.T) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(strings.Repeat("hoge\n", 2000)))
+	zw.Close()
+
+	tests := []struct {
+		name string
+		in   []byte
+		want Compression
+	}{
+		{"zlib", z.Bytes(), Zlib},
+		// ヘッダだけzlibに見えるテキスト
+		{"x^", []byte("x^2 + y^2\n"), NoCompression},
+		{"HK", []byte("HK hello\n"), NoCompression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detect(bufio.NewReader(bytes.NewReader(tt.in))); got != tt.want {
+				t.Errorf("detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
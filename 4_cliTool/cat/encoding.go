@@ -0,0 +1,122 @@
+package cat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// AutoEncoding をOptions.Encodingに指定すると入力の文字コードを推測する。
+const AutoEncoding = "auto"
+
+// sniffSize は文字コードの推測に使う先頭のバイト数。
+const sniffSize = 64 * 1024
+
+// lookupEncoding は文字コード名に対応するencoding.Encodingを返す。
+// 名前は "shift_jis", "euc-jp", "utf-16le" などWHATWGの名前を使う。
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
+
+// toUTF8 は r をUTF-8に変換するReaderを返す。
+// enc がnilの場合は先頭から文字コードを推測する。
+// UTF-8とUTF-16のBOMは取り除く。
+func toUTF8(r io.Reader, enc encoding.Encoding) io.Reader {
+	if enc == nil {
+		br := bufio.NewReaderSize(r, sniffSize)
+		// 読めた分だけで推測するのでエラーは無視する
+		sample, _ := br.Peek(sniffSize)
+		enc = guessEncoding(sample)
+		r = br
+	}
+	return transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder()))
+}
+
+// guessEncoding はUTF-8, Shift_JIS, EUC-JPのうち
+// sample として正しいものを返す。
+// Shift_JISとEUC-JPの両方として正しい場合はEUC-JPとみなす。
+// Shift_JISのひらがな(0x82xx)はEUC-JPとして正しくないため。
+func guessEncoding(sample []byte) encoding.Encoding {
+	switch {
+	case validUTF8(sample):
+		return unicode.UTF8
+	case validEUCJP(sample):
+		return japanese.EUCJP
+	case validShiftJIS(sample):
+		return japanese.ShiftJIS
+	}
+	return unicode.UTF8
+}
+
+// validUTF8 は末尾で途切れた文字を許してUTF-8として正しいかを返す。
+func validUTF8(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(b)
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+func validEUCJP(b []byte) bool {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		var n int // 後に続くバイト数
+		switch {
+		case c < 0x80:
+			continue
+		case c == 0x8e: // 半角カナ
+			n = 1
+		case c == 0x8f: // 補助漢字
+			n = 2
+		case 0xa1 <= c && c <= 0xfe:
+			n = 1
+		default:
+			return false
+		}
+		for ; n > 0; n-- {
+			i++
+			if i == len(b) {
+				return true
+			}
+			if b[i] < 0xa1 || b[i] > 0xfe {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validShiftJIS(b []byte) bool {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80, 0xa1 <= c && c <= 0xdf: // ASCIIと半角カナ
+			continue
+		case 0x81 <= c && c <= 0x9f, 0xe0 <= c && c <= 0xfc:
+			i++
+			if i == len(b) {
+				return true
+			}
+			if t := b[i]; t < 0x40 || t == 0x7f || t > 0xfc {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
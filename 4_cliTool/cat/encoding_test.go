@@ -0,0 +1,97 @@
+package cat
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const sample = "日本語のテキスト、ｶﾀｶﾅ\nabc\n"
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGuessEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		sample []byte
+		want   encoding.Encoding
+	}{
+		{"UTF-8", []byte(sample), unicode.UTF8},
+		{"ASCII", []byte("abc\n"), unicode.UTF8},
+		{"empty", nil, unicode.UTF8},
+		// 最後の文字が途中で切れていてもUTF-8とみなす
+		{"truncated UTF-8", []byte(sample)[:len("日本")+1], unicode.UTF8},
+		{"Shift_JIS", encode(t, japanese.ShiftJIS, sample), japanese.ShiftJIS},
+		{"Shift_JIS hiragana", encode(t, japanese.ShiftJIS, "こんにちは"), japanese.ShiftJIS},
+		{"EUC-JP", encode(t, japanese.EUCJP, sample), japanese.EUCJP},
+		{"EUC-JP hiragana", encode(t, japanese.EUCJP, "こんにちは"), japanese.EUCJP},
+		// どれとしても正しくなければUTF-8とみなす
+		{"binary", []byte{0xff, 0xfe, 0x00, 0x80}, unicode.UTF8},
+	} {
+		if got := guessEncoding(tt.sample); got != tt.want {
+			t.Errorf("%s: guessEncoding() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// BOMがあればその文字コードとして読み、BOMは取り除く。
+func TestToUTF8(t *testing.T) {
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	utf16be := unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	for _, tt := range []struct {
+		name  string
+		input []byte
+		enc   encoding.Encoding // nilなら推測する
+	}{
+		{"UTF-8", []byte(sample), nil},
+		{"UTF-8 BOM", append([]byte("\xef\xbb\xbf"), sample...), nil},
+		{"UTF-16LE BOM", encode(t, utf16le, sample), nil},
+		{"UTF-16BE BOM", encode(t, utf16be, sample), nil},
+		{"Shift_JIS", encode(t, japanese.ShiftJIS, sample), nil},
+		{"EUC-JP", encode(t, japanese.EUCJP, sample), nil},
+		// 指定した文字コードよりBOMを優先する
+		{"UTF-8 BOM as Shift_JIS", append([]byte("\xef\xbb\xbf"), sample...), japanese.ShiftJIS},
+		{"UTF-16LE BOM as EUC-JP", encode(t, utf16le, sample), japanese.EUCJP},
+		{"Shift_JIS given", encode(t, japanese.ShiftJIS, sample), japanese.ShiftJIS},
+	} {
+		got, err := io.ReadAll(toUTF8(bytes.NewReader(tt.input), tt.enc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != sample {
+			t.Errorf("%s: got %q, want %q", tt.name, got, sample)
+		}
+	}
+}
+
+// --from-encoding autoでは、BOMのあるUTF-16のファイルもUTF-8で出力する。
+func TestConcatEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	input := encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), sample)
+	if err := os.WriteFile(path, input, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AutoEncoding, "utf-16le"} {
+		var buf bytes.Buffer
+		if err := Concat(&buf, Options{Encoding: name}, path); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != sample {
+			t.Errorf("%s: got %q, want %q", name, buf.String(), sample)
+		}
+	}
+}
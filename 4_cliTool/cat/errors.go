@@ -0,0 +1,60 @@
+package cat
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// FileError はファイルの読み込みに失敗したときのエラー。
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// newFileError はerrが*fs.PathErrorならパスの重複を避けて中身だけを持つ。
+func newFileError(path string, err error) *FileError {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &FileError{Path: path, Err: err}
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Errors は読み込みに失敗したファイルのエラーをまとめたもの。
+type Errors []*FileError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// errWriter は最初の書き込みエラーを覚えておく。
+// 読み込みのエラーと書き込みのエラーを区別するために使う。
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(b []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(b)
+	if err != nil {
+		ew.err = err
+	}
+	return n, err
+}
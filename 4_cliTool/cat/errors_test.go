@@ -0,0 +1,38 @@
+package cat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// OnErrorは失敗したときにすぐ呼ばれ、エラーは戻り値にもまとめられる。
+func TestOnError(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	missing := filepath.Join(dir, "missing.txt")
+	if err := os.WriteFile(a, []byte("hoge\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var seen []string
+	opts := Options{OnError: func(err *FileError) {
+		// ここまでに出力した内容を覚えておく
+		seen = append(seen, buf.String()+err.Path)
+	}}
+	err := Concat(&buf, opts, a, missing, a)
+
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != missing {
+		t.Fatalf("Concat() = %v, want an error for %s", err, missing)
+	}
+	if want := []string{"hoge\n" + missing}; len(seen) != 1 || seen[0] != want[0] {
+		t.Errorf("OnError saw %q, want %q", seen, want)
+	}
+	if got, want := buf.String(), "hoge\nhoge\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package cat
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval はFollowで追記を確認する間隔のデフォルト値。
+const DefaultPollInterval = time.Second
+
+// flusher はbufio.Writerのように書き出しを溜めるWriter。
+type flusher interface {
+	Flush() error
+}
+
+// follow は tail -f のように fn への追記を ctx が終わるまで出力し続ける。
+// f は fn を開いたファイルで、末尾まで読み終わっている必要がある。
+//
+// ファイルが切り詰められたら先頭から読み直し、
+// ローテーションで別のファイルに置き換わったら開き直す。
+// 行番号は続きから付ける。
+func (p *printer) follow(ctx context.Context, fn string, f *os.File) error {
+	defer func() {
+		// 開き直すと f が変わるので、最後に開いていたものを閉じる
+		f.Close()
+	}()
+
+	ticker := time.NewTicker(p.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// 追記された分を出力する
+		if err := p.copyLines(f); err != nil {
+			return err
+		}
+
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		pos, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if cur.Size() < pos {
+			// 切り詰められたので先頭から読み直す
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// ローテーション中は一時的にファイルがないことがあるので待つ
+		latest, err := os.Stat(fn)
+		if err != nil || os.SameFile(cur, latest) {
+			continue
+		}
+		nf, err := os.Open(fn)
+		if err != nil {
+			continue
+		}
+		f.Close()
+		f = nf
+	}
+}
+
+// flush はConcatに渡されたWriterが書き出しを溜めていれば書き出す。
+func (p *printer) flush() error {
+	if fw, ok := p.out.(flusher); ok {
+		return fw.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package cat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Selection は出力する行の選び方。
+// 行の位置は1から数え、行番号と同じく入力の行で数える。
+type Selection struct {
+	From, To int  // From行目からTo行目まで(両端を含む)を出力する。0なら制限しない
+	Tail     int  // 0より大きければ最後のTail行だけを出力する。From, Toより優先される
+	Global   bool // ファイルごとではなく、連結した全体に対して選ぶ
+}
+
+// ParseLines は "10:20", "10:", ":20", "15" の形式の範囲を解析する。
+func ParseLines(s string) (Selection, error) {
+	from, to, found := strings.Cut(s, ":")
+	var sel Selection
+	var err error
+	if from != "" {
+		if sel.From, err = parseLineNumber(from); err != nil {
+			return Selection{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	if !found {
+		// 1行だけ
+		sel.To = sel.From
+		return sel, nil
+	}
+	if to != "" {
+		if sel.To, err = parseLineNumber(to); err != nil {
+			return Selection{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	if sel.To > 0 && sel.From > sel.To {
+		return Selection{}, fmt.Errorf("invalid range %q: start is after end", s)
+	}
+	return sel, nil
+}
+
+func parseLineNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("line numbers start at 1")
+	}
+	return n, nil
+}
+
+// active は行を選ぶ必要があるかを返す。
+func (sel Selection) active() bool {
+	return sel.From > 0 || sel.To > 0 || sel.Tail > 0
+}
+
+// contains は pos 行目を出力するかを返す。
+func (sel Selection) contains(pos int) bool {
+	return pos >= sel.From && (sel.To == 0 || pos <= sel.To)
+}
+
+// errStop はSelection.Toより後の行を読む必要がないことを表す。
+var errStop = errors.New("cat: no more lines selected")
+
+// stop はSelection.Toより後の行に来たときに errStop を返す。
+// ファイルごとに選ぶ場合は、次のファイルの行番号が元の位置のままになるように
+// 今の行(空行なら blank)と残りの行を数える。eol は今の行を読み終えたか。
+func (p *printer) stop(blank, eol bool) error {
+	if p.opts.Select.Global || !(p.opts.Number || p.opts.NumberNonBlank) {
+		return errStop
+	}
+	p.skip(blank)
+	if err := p.skipLines(p.br, eol); err != nil {
+		return err
+	}
+	return errStop
+}
+
+// collectChunk は最後のTail行を残すために行を溜める。
+// 溜めきれずに捨てた行は行番号のために数える。
+func (p *printer) collectChunk(chunk []byte) error {
+	p.partial = append(p.partial, chunk...)
+	if chunk[len(chunk)-1] == '\n' {
+		p.pushTail()
+	}
+	return nil
+}
+
+// pushTail は溜めている行をリングバッファに入れる。
+func (p *printer) pushTail() {
+	if len(p.partial) == 0 {
+		return
+	}
+	if len(p.tail) < p.opts.Select.Tail {
+		p.tail = append(p.tail, p.partial)
+		p.partial = nil
+		return
+	}
+
+	// 一番古い行を捨てて、そのメモリを使い回す
+	oldest := p.tail[p.tailHead]
+	p.skip(len(oldest) == 1 && oldest[0] == '\n')
+	p.tail[p.tailHead] = p.partial
+	p.tailHead = (p.tailHead + 1) % len(p.tail)
+	p.partial = oldest[:0]
+}
+
+// flushTail は溜めていた行を出力する。
+func (p *printer) flushTail() error {
+	p.pushTail()
+	n := len(p.tail)
+	for i := 0; i < n; i++ {
+		if err := p.writeChunk(p.tail[(p.tailHead+i)%n]); err != nil {
+			return err
+		}
+	}
+	p.tail, p.tailHead, p.partial = p.tail[:0], 0, nil
+	return p.flushCR()
+}
+
+// seekable はファイルの末尾から読めるかを返す。
+// 圧縮の展開や文字コードの変換をする場合は先頭から読む必要がある。
+func (p *printer) seekable(f *os.File) bool {
+	if p.opts.Decompress != NoCompression || p.opts.Encoding != "" {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode().IsRegular()
+}
+
+// seekTail はファイルの最後のTail行だけを出力する。
+// ファイル全体をメモリに読み込まないように、末尾からさかのぼって開始位置を探す。
+func (p *printer) seekTail(f *os.File) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	off, err := tailOffset(f, st.Size(), p.opts.Select.Tail)
+	if err != nil {
+		return err
+	}
+
+	// 行番号を付けるなら読み飛ばす行を数える必要がある
+	if p.opts.Number || p.opts.NumberNonBlank {
+		if err := p.skipLines(io.NewSectionReader(f, 0, off), true); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	if err := p.readChunks(f, p.writeChunk); err != nil {
+		return err
+	}
+	return p.flushCR()
+}
+
+// tailOffset は最後の n 行が始まる位置を返す。
+func tailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	const blockSize = 32 * 1024
+	buf := make([]byte, blockSize)
+
+	// 末尾の改行は最後の行の終わりなので数えない
+	end := size
+	if size > 0 {
+		if _, err := r.ReadAt(buf[:1], size-1); err != nil {
+			return 0, err
+		}
+		if buf[0] == '\n' {
+			end--
+		}
+	}
+
+	count := 0
+	for end > 0 {
+		start := end - blockSize
+		if start < 0 {
+			start = 0
+		}
+		b := buf[:end-start]
+		if _, err := r.ReadAt(b, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] != '\n' {
+				continue
+			}
+			if count++; count == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// skipLines は r の行を出力せずに数える。
+// lineStart がfalseなら、r の最初は数え終えた行の続き。
+func (p *printer) skipLines(r io.Reader, lineStart bool) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, c := range buf[:n] {
+			if lineStart {
+				p.skip(c == '\n')
+			}
+			lineStart = c == '\n'
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skip は出力しない行を行番号のために数える。
+func (p *printer) skip(blank bool) {
+	if p.numbered(blank) {
+		p.line++
+	}
+}
@@ -0,0 +1,59 @@
+package cat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 途中で出力をやめたファイルの残りの行も、次のファイルの行番号のために数える。
+func TestSelectionKeepsLineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("hoge\n\nhoge hoge\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("fuga\nfugafuga\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"head", Options{Number: true, Select: Selection{To: 1}}, "1: hoge\n4: fuga\n"},
+		{"lines", Options{Number: true, Select: Selection{From: 1, To: 1}}, "1: hoge\n4: fuga\n"},
+		{"range", Options{Number: true, Select: Selection{From: 2, To: 2}}, "2: \n5: fugafuga\n"},
+		{"nonblank", Options{NumberNonBlank: true, Select: Selection{To: 1}}, "1: hoge\n3: fuga\n"},
+		{"global", Options{Number: true, Select: Selection{From: 3, To: 4, Global: true}}, "3: hoge hoge\n4: fuga\n"},
+		{"unnumbered", Options{Select: Selection{To: 1}}, "hoge\nfuga\n"},
+	}
+	// バッファより長い行の途中で止まっても数え間違えない
+	long := filepath.Join(dir, "long.txt")
+	if err := os.WriteFile(long, []byte("x\n"+strings.Repeat("y", 10000)+"\nz\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Concat(&buf, Options{Number: true, Select: Selection{To: 1}}, long, b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "1: x\n4: fuga\n"; got != want {
+		t.Errorf("long line: got %q, want %q", got, want)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Concat(&buf, tt.opts, a, b); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
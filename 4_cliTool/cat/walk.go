@@ -0,0 +1,130 @@
+package cat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walker はディレクトリをたどって出力するファイルを集める。
+type walker struct {
+	include, exclude []string
+	visited          []os.FileInfo // たどったディレクトリ。シンボリックリンクのループを防ぐ
+	files            []string
+	errs             Errors
+}
+
+// expand は files のうちディレクトリを、その下のファイルに置き換える。
+// ファイルは名前順に並ぶ。
+func expand(files []string, include, exclude []string) ([]string, Errors) {
+	wk := &walker{include: include, exclude: exclude}
+	for _, fn := range files {
+		if fn == Stdin {
+			wk.files = append(wk.files, fn)
+			continue
+		}
+		info, err := os.Stat(fn)
+		if err != nil || !info.IsDir() {
+			// エラーは読み込むときに報告する
+			wk.files = append(wk.files, fn)
+			continue
+		}
+		wk.walk(fn, fn)
+	}
+	return wk.files, wk.errs
+}
+
+// walk は dir 以下をたどる。
+// シンボリックリンクの先をたどるときは、dir が実際のパスで
+// name が表示に使うリンクのパスになる。
+func (wk *walker) walk(name, dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		display := name + strings.TrimPrefix(path, dir)
+		if err != nil {
+			wk.errs = append(wk.errs, newFileError(display, err))
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			if path != dir && match(wk.exclude, info.Name()) {
+				return filepath.SkipDir
+			}
+			if wk.seen(info) {
+				return filepath.SkipDir
+			}
+			wk.visited = append(wk.visited, info)
+		case info.Mode()&os.ModeSymlink != 0:
+			wk.followLink(display, path)
+		case info.Mode().IsRegular():
+			wk.add(display, info.Name())
+		}
+		return nil
+	})
+}
+
+// followLink はシンボリックリンクの先がディレクトリならたどり、
+// ファイルなら追加する。
+func (wk *walker) followLink(display, path string) {
+	target, err := os.Stat(path)
+	if err != nil {
+		wk.errs = append(wk.errs, newFileError(display, err))
+		return
+	}
+	name := filepath.Base(path)
+	if !target.IsDir() {
+		wk.add(display, name)
+		return
+	}
+	if match(wk.exclude, name) {
+		return
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		wk.errs = append(wk.errs, newFileError(display, err))
+		return
+	}
+	wk.walk(display, real)
+}
+
+func (wk *walker) add(path, name string) {
+	if len(wk.include) > 0 && !match(wk.include, name) {
+		return
+	}
+	if match(wk.exclude, name) {
+		return
+	}
+	wk.files = append(wk.files, path)
+}
+
+// seen はディレクトリをすでにたどったかを返す。
+func (wk *walker) seen(info os.FileInfo) bool {
+	for _, v := range wk.visited {
+		if os.SameFile(v, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// match は name がいずれかのパターンに一致するかを返す。
+// パターンはValidatePatternsで確認しておく。
+func match(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePatterns はIncludeとExcludeのパターンが正しいかを確認する。
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
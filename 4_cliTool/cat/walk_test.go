@@ -0,0 +1,108 @@
+package cat
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testTree は次のディレクトリを作って、root と外のディレクトリを返す。
+//
+//	root/a.log
+//	root/b.txt
+//	root/link.txt -> sub/c.txt
+//	root/skip/e.txt
+//	root/sub/c.txt
+//	root/sub/deep/d.txt
+//	root/sub/ext -> outside
+//	root/sub/up -> root (祖先へのループ)
+//	outside/f.txt
+func testTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	dir := t.TempDir()
+	root, outside = filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, fn := range []string{
+		"root/a.log", "root/b.txt", "root/skip/e.txt",
+		"root/sub/c.txt", "root/sub/deep/d.txt", "outside/f.txt",
+	} {
+		path := filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fn+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"root/link.txt": "sub/c.txt",
+		"root/sub/ext":  outside,
+		"root/sub/up":   "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	return root, outside
+}
+
+func TestExpand(t *testing.T) {
+	root, _ := testTree(t)
+	for _, tt := range []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"all", nil, nil, []string{
+			"a.log", "b.txt", "link.txt", "skip/e.txt",
+			"sub/c.txt", "sub/deep/d.txt", "sub/ext/f.txt",
+		}},
+		{"include", []string{"*.txt"}, nil, []string{
+			"b.txt", "link.txt", "skip/e.txt",
+			"sub/c.txt", "sub/deep/d.txt", "sub/ext/f.txt",
+		}},
+		{"exclude", nil, []string{"skip", "deep", "*.log"}, []string{
+			"b.txt", "link.txt", "sub/c.txt", "sub/ext/f.txt",
+		}},
+		{"include and exclude", []string{"*.txt"}, []string{"ext", "c.txt"}, []string{
+			"b.txt", "link.txt", "skip/e.txt", "sub/deep/d.txt",
+		}},
+		{"several includes", []string{"a.*", "d.txt"}, nil, []string{
+			"a.log", "sub/deep/d.txt",
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := expand([]string{root}, tt.include, tt.exclude)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			want := make([]string, len(tt.want))
+			for i, fn := range tt.want {
+				want[i] = filepath.Join(root, fn)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expand() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+// ディレクトリでない引数は、そのままの順で残る。
+func TestExpandArgs(t *testing.T) {
+	root, outside := testTree(t)
+	missing := filepath.Join(root, "missing.txt")
+	got, errs := expand([]string{filepath.Join(root, "b.txt"), Stdin, outside, missing, filepath.Join(root, "sub", "deep")}, nil, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	want := []string{
+		filepath.Join(root, "b.txt"),
+		Stdin,
+		filepath.Join(outside, "f.txt"),
+		missing,
+		filepath.Join(root, "sub", "deep", "d.txt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expand() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"cliTool/imgconv"
+)
+
+// assemble はディレクトリの連番の画像からアニメーションGIFを作る。
+func assemble(args []string) int {
+	fs := flag.NewFlagSet("imgconv assemble", flag.ExitOnError)
+	delay := fs.Int("delay", 10, "各フレームの表示時間 (1/100秒)")
+	loop := fs.Int("loop", 0, "繰り返す回数 (0は無限、-1は繰り返さない)")
+	ops := fs.String("ops", "", "各フレームに順に適用する変換 (例: resize=320x0,gray)")
+	quantize := quantizeFlags(fs)
+	out := fs.String("o", "anim.gif", "出力するGIFファイル")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv assemble [flags] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *delay < 0 || *loop < -1 {
+		fmt.Fprintln(os.Stderr, "imgconv: -delay must not be negative, -loop must be at least -1")
+		return 2
+	}
+	apply, err := imgconv.ParseOps(*ops)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+
+	q, err := quantize()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+
+	a, err := imgconv.AssembleDir(fs.Arg(0), *delay)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	a.LoopCount = *loop
+	a = a.Apply(apply...)
+	if q != nil {
+		a = a.Apply(func(img imgconv.Img) imgconv.Img { return img.Quantize(*q) })
+	}
+	if err := a.Save(*out); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	return 0
+}
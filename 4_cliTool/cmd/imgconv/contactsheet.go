@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/jpeg"
+	"os"
+
+	"cliTool/imgconv"
+)
+
+// contactSheet はディレクトリの画像の一覧画像を作る。
+// 出力の形式は -o の拡張子で決まる。
+func contactSheet(args []string) int {
+	fs := flag.NewFlagSet("imgconv contactsheet", flag.ExitOnError)
+	var cs imgconv.ContactSheet
+	var opts imgconv.EncodeOptions
+	fs.IntVar(&cs.Columns, "cols", 4, "1行に並べるサムネイルの数")
+	fs.IntVar(&cs.ThumbSize, "size", 160, "サムネイルの幅と高さの最大")
+	fs.IntVar(&cs.Padding, "padding", 8, "サムネイルの間の余白")
+	bg := fs.String("bg", "white", "背景色 (white, #202020 など)")
+	fs.BoolVar(&cs.Labels, "labels", false, "サムネイルの下にファイル名を描く")
+	resize := fs.String("resize", "catmullrom", "縮小の補間方法 (nearest, bilinear, catmullrom)")
+	out := fs.String("o", "contactsheet.png", "出力するファイル (.png, .jpg など)")
+	fs.IntVar(&opts.JPEGQuality, "quality", jpeg.DefaultQuality, "JPEGの品質 (1-100)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv contactsheet [flags] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if cs.Background, err = imgconv.ParseColor(*bg); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if cs.Resize, err = imgconv.ParseInterpolation(*resize); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if cs.Columns < 1 || cs.ThumbSize < 1 || cs.Padding < 0 {
+		fmt.Fprintln(os.Stderr, "imgconv: -cols and -size must be positive, -padding must not be negative")
+		return 2
+	}
+	if opts.JPEGQuality < 1 || opts.JPEGQuality > 100 {
+		fmt.Fprintln(os.Stderr, "imgconv: -quality must be between 1 and 100")
+		return 2
+	}
+	if format, err := imgconv.FormatOf(*out); err != nil || format.Encode == nil {
+		fmt.Fprintf(os.Stderr, "imgconv: cannot write %s\n", *out)
+		return 2
+	}
+
+	sheet, failures, err := cs.BuildDir(fs.Arg(0))
+	for _, f := range failures {
+		fmt.Fprintln(os.Stderr, "imgconv:", f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	if err := sheet.Save(*out, &opts); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	if len(failures) > 0 {
+		return 1
+	}
+	return 0
+}
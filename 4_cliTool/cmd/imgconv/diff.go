@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"cliTool/imgconv"
+)
+
+// diff は2枚の画像を比べる。
+// 大きさが違うか、違う画素の割合が -threshold を超えたら1を返す。
+// 画像を読み込めないなど、比べられなかった場合は2を返す。
+func diff(args []string) int {
+	fs := flag.NewFlagSet("imgconv diff", flag.ExitOnError)
+	tolerance := fs.Int("tolerance", 0, "各チャンネルの差がこれ以下なら同じ画素とみなす (0-255)")
+	threshold := fs.Float64("threshold", 0, "違う画素の割合(%)がこれを超えたら失敗にする")
+	out := fs.String("o", "", "違う画素を赤くした画像を書き出すファイル")
+	asJSON := fs.Bool("json", false, "JSONで出力する")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv diff [flags] a b")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	if *tolerance < 0 || *tolerance > 255 {
+		fmt.Fprintln(os.Stderr, "imgconv: -tolerance must be between 0 and 255")
+		return 2
+	}
+	if *threshold < 0 || *threshold > 100 {
+		fmt.Fprintln(os.Stderr, "imgconv: -threshold must be between 0 and 100")
+		return 2
+	}
+
+	a, err := imgconv.LoadImage(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	b, err := imgconv.LoadImage(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+
+	r, err := imgconv.Diff(a, b, *tolerance)
+	var se *imgconv.SizeMismatchError
+	if errors.As(err, &se) {
+		return sizeMismatch(a.Path, b.Path, se, *asJSON)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if *out != "" {
+		if err := r.Map.Save(*out, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "imgconv:", err)
+			return 2
+		}
+	}
+	failed := r.Percent() > *threshold
+
+	if *asJSON {
+		// JSONではInfを書けないので、同じ画像のPSNRはnullにする
+		var psnr *float64
+		if !math.IsInf(r.PSNR, 0) {
+			psnr = &r.PSNR
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			A            string   `json:"a"`
+			B            string   `json:"b"`
+			SizeA        [2]int   `json:"size_a"`
+			SizeB        [2]int   `json:"size_b"`
+			SizeMismatch bool     `json:"size_mismatch"`
+			Pixels       int      `json:"pixels"`
+			Differing    int      `json:"differing"`
+			Percent      float64  `json:"percent"`
+			PSNR         *float64 `json:"psnr"`
+			SSIM         float64  `json:"ssim"`
+			Failed       bool     `json:"failed"`
+		}{
+			A:         a.Path,
+			B:         b.Path,
+			SizeA:     [2]int{r.Size.X, r.Size.Y},
+			SizeB:     [2]int{r.Size.X, r.Size.Y},
+			Pixels:    r.Pixels,
+			Differing: r.Differing,
+			Percent:   r.Percent(),
+			PSNR:      psnr,
+			SSIM:      r.SSIM,
+			Failed:    failed,
+		})
+	} else {
+		fmt.Printf("size: %dx%d\n", r.Size.X, r.Size.Y)
+		fmt.Printf("differing: %d / %d pixels (%.2f%%)\n", r.Differing, r.Pixels, r.Percent())
+		fmt.Printf("psnr: %.2f dB\n", r.PSNR)
+		_, err = fmt.Printf("ssim: %.4f\n", r.SSIM)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// sizeMismatch は大きさが違って比べられなかったことを出力して1を返す。
+func sizeMismatch(a, b string, se *imgconv.SizeMismatchError, asJSON bool) int {
+	var err error
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			A            string `json:"a"`
+			B            string `json:"b"`
+			SizeA        [2]int `json:"size_a"`
+			SizeB        [2]int `json:"size_b"`
+			SizeMismatch bool   `json:"size_mismatch"`
+			Failed       bool   `json:"failed"`
+		}{
+			A:            a,
+			B:            b,
+			SizeA:        [2]int{se.A.X, se.A.Y},
+			SizeB:        [2]int{se.B.X, se.B.Y},
+			SizeMismatch: true,
+			Failed:       true,
+		})
+	} else {
+		_, err = fmt.Printf("size: %dx%d != %dx%d\n", se.A.X, se.A.Y, se.B.X, se.B.Y)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+
+	"cliTool/imgconv"
+)
+
+// dupes はディレクトリ以下から見た目の似た画像を探して、まとまりごとに表示する。
+func dupes(args []string) int {
+	fs := flag.NewFlagSet("imgconv dupes", flag.ExitOnError)
+	var f imgconv.DupeFinder
+	kind := fs.String("hash", "phash", "知覚ハッシュの種類 (ahash, dhash, phash)")
+	fs.IntVar(&f.Threshold, "threshold", 8, "ハミング距離がこの値以下(この値を含む)なら同じ画像とみなす (0-64)")
+	fs.BoolVar(&f.Decode.IgnoreOrientation, "no-orient", false, "EXIFの向きに合わせて回転しない")
+	fs.IntVar(&f.Jobs, "j", runtime.NumCPU(), "同時に読み込むファイルの数")
+	asJSON := fs.Bool("json", false, "JSONで出力する")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv dupes [flags] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if f.Kind, err = imgconv.ParseHashKind(*kind); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if f.Threshold < 0 || f.Threshold > 64 {
+		fmt.Fprintln(os.Stderr, "imgconv: -threshold must be between 0 and 64")
+		return 2
+	}
+	if f.Jobs < 1 {
+		fmt.Fprintln(os.Stderr, "imgconv: -j must be at least 1")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := f.FindDirContext(ctx, fs.Arg(0))
+	if report == nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	for _, f := range report.Failed {
+		fmt.Fprintln(os.Stderr, "imgconv:", f)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		groups := report.Groups
+		if groups == nil {
+			groups = [][]imgconv.HashedFile{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(groups)
+	} else {
+		// まとまりは空行で区切る
+		for i, g := range report.Groups {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			for _, file := range g {
+				fmt.Fprintf(w, "%s  %s\n", file.Hash, file.Path)
+			}
+		}
+	}
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	if len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"cliTool/imgconv"
+)
+
+// info は画像の形式、大きさ、色のモデルを表示する。
+// -histogram を付けると画像を全て読み込んでヒストグラムも表示する。
+func info(args []string) int {
+	fs := flag.NewFlagSet("imgconv info", flag.ExitOnError)
+	histogram := fs.Bool("histogram", false, "画像を全て読み込んでヒストグラムと輝度を表示する")
+	asJSON := fs.Bool("json", false, "JSONで出力する")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv info [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	type result struct {
+		*imgconv.Info
+		Histogram *imgconv.Histogram `json:"histogram,omitempty"`
+	}
+	results := []result{}
+	code := 0
+	for _, path := range fs.Args() {
+		r, err := inspect(path, *histogram)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "imgconv:", err)
+			code = 1
+			continue
+		}
+		results = append(results, result{r.info, r.hist})
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	} else {
+		for _, r := range results {
+			fmt.Fprintf(w, "%s: %s %dx%d %s\n", r.Path, r.Format, r.Width, r.Height, r.ColorModel)
+			if r.Histogram != nil {
+				printHistogram(w, r.Histogram)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	return code
+}
+
+type inspected struct {
+	info *imgconv.Info
+	hist *imgconv.Histogram
+}
+
+// inspect は path の情報を調べ、histogram ならヒストグラムも作る。
+func inspect(path string, histogram bool) (inspected, error) {
+	info, err := imgconv.LoadInfo(path)
+	if err != nil || !histogram {
+		return inspected{info: info}, err
+	}
+	// ヒストグラムは向きに関係ないので回転しない
+	img, err := imgconv.LoadImageWith(path, &imgconv.DecodeOptions{IgnoreOrientation: true})
+	if err != nil {
+		return inspected{}, err
+	}
+	hist, err := img.Histogram()
+	if err != nil {
+		return inspected{}, &imgconv.Failure{Path: path, Err: err}
+	}
+	return inspected{info: info, hist: hist}, nil
+}
+
+// printHistogram は各チャンネルのヒストグラムを32段の棒で表示する。
+func printHistogram(w io.Writer, h *imgconv.Histogram) {
+	for _, ch := range []struct {
+		name   string
+		counts *[256]int
+	}{
+		{"R", &h.R}, {"G", &h.G}, {"B", &h.B}, {"A", &h.A}, {"L", &h.Luma},
+	} {
+		fmt.Fprintf(w, "  %s %s\n", ch.name, sparkline(ch.counts))
+	}
+	fmt.Fprintf(w, "  luma: mean %.1f, min %d, max %d\n", h.MeanLuma, h.MinLuma, h.MaxLuma)
+}
+
+var bars = []rune(" ▁▂▃▄▅▆▇█")
+
+// sparkline は256段のヒストグラムを8段ずつまとめ、一番多い段を█にした棒で返す。
+func sparkline(counts *[256]int) string {
+	var buckets [32]int
+	max := 0
+	for i, n := range counts {
+		buckets[i/8] += n
+		if buckets[i/8] > max {
+			max = buckets[i/8]
+		}
+	}
+	line := make([]rune, len(buckets))
+	for i, n := range buckets {
+		level := 0
+		if n > 0 {
+			// 少しでもあれば見えるようにする
+			level = 1 + (n*(len(bars)-2))/max
+		}
+		line[i] = bars[level]
+	}
+	return string(line)
+}
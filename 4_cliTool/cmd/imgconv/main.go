@@ -0,0 +1,243 @@
+// imgconv はQ2の画像変換コマンド。
+// 指定したディレクトリ以下のJPGファイルをPNGに変換する。
+// 変換前と変換後の画像形式は -from と -to で指定できる。
+//
+//	$ imgconv [-from jpg] [-to png] [-o dir] [-gray] [-ops list] [-j N] dir
+//
+// -ops には変換をカンマで区切って並べる。
+//
+//	$ imgconv -ops "resize=800x0,gray,rotate=90" dir
+//
+// 出力先の名前は -name のテンプレートで変えられる。すでにある出力先は -overwrite に従い、
+// デフォルトでは変換しない。-dry-run を付けると、変換せずに予定だけを表示する。
+//
+//	$ imgconv -gray -name "{dir}/{name}_gray.{ext}" -overwrite rename -dry-run dir
+//
+// -colors を付けると、-ops の後にその色の数に減色する。
+//
+//	$ imgconv -to gif -colors 64 -dither fs dir
+//
+// contactsheet はディレクトリの画像のサムネイルを並べた一覧画像を作る。
+//
+//	$ imgconv contactsheet [-cols 4] [-size 160] [-labels] [-o sheet.png] dir
+//
+// dupes は知覚ハッシュで見た目の似た画像を探す。
+//
+//	$ imgconv dupes [-hash phash] [-threshold 8] [-json] dir
+//
+// アニメーションGIFはフレームごとに変換する。-to gif ならアニメーションGIFに、
+// -frames を付けるとフレームを連番のファイルにする。
+// assemble は逆に、ディレクトリの連番の画像からアニメーションGIFを作る。
+//
+//	$ imgconv -from gif -to png -frames dir
+//	$ imgconv assemble [-delay 10] [-loop 0] [-o anim.gif] dir
+//
+// diff は2枚の画像を比べ、違う画素の数とPSNR、SSIMを表示する。
+// 違う画素の割合が -threshold を超えると終了コード1で終わるので、テストに使える。
+//
+//	$ imgconv diff [-tolerance 2] [-threshold 0.5] [-o diff.png] a.png b.png
+//
+// info は画像を全て読み込まずに形式、大きさ、色のモデルを表示する。
+// -histogram を付けると、全て読み込んでチャンネルごとのヒストグラムと輝度を表示する。
+//
+//	$ imgconv info [-histogram] [-json] file...
+//
+// 読み込める形式: jpeg, png, gif, bmp, tiff, webp
+// 書き出せる形式: jpeg, png, gif, bmp, tiff
+//
+// 変換の処理はimgconvパッケージにある。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"os/signal"
+	"runtime"
+
+	"cliTool/imgconv"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run は最初の引数がサブコマンドの名前ならそれを実行し、そうでなければ変換する。
+func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "contactsheet":
+			return contactSheet(args[1:])
+		case "dupes":
+			return dupes(args[1:])
+		case "assemble":
+			return assemble(args[1:])
+		case "diff":
+			return diff(args[1:])
+		case "info":
+			return info(args[1:])
+		}
+	}
+	return convert(args)
+}
+
+func convert(args []string) int {
+	fs := flag.NewFlagSet("imgconv", flag.ExitOnError)
+	var c imgconv.Converter
+	from := fs.String("from", "jpg", "変換前の画像形式")
+	to := fs.String("to", "png", "変換後の画像形式")
+	fs.IntVar(&c.Encode.JPEGQuality, "quality", jpeg.DefaultQuality, "JPEGの品質 (1-100)")
+	compression := fs.String("compression", "default", "PNGの圧縮レベル (default, none, speed, best)")
+	fs.StringVar(&c.OutDir, "o", "", "出力先のディレクトリ (デフォルトは元のファイルと同じ場所)")
+	fs.BoolVar(&c.Gray, "gray", false, "グレースケールに変換する")
+	ops := fs.String("ops", "", "順に適用する変換 (例: resize=800x0,gray,rotate=90)")
+	fs.BoolVar(&c.Decode.IgnoreOrientation, "no-orient", false, "EXIFの向きに合わせて回転しない")
+	fs.BoolVar(&c.Encode.KeepMetadata, "keep-meta", false, "EXIFを変換後の画像に入れる (JPEG, PNGのみ)")
+	quantize := quantizeFlags(fs)
+	fs.BoolVar(&c.Frames, "frames", false, "GIFの全てのフレームを、拡張子を除いたディレクトリに連番のファイルで書き出す")
+	fs.IntVar(&c.Jobs, "j", runtime.NumCPU(), "同時に変換するファイルの数")
+	fs.StringVar(&c.Template, "name", imgconv.DefaultTemplate, "出力先のテンプレート ({dir}, {name}, {ext})")
+	overwrite := fs.String("overwrite", "skip", "出力先がすでにあるときの扱い (skip, overwrite, rename)")
+	fs.BoolVar(&c.RemoveOriginals, "rm", false, "変換できた元のファイルを消す")
+	dryRun := fs.Bool("dry-run", false, "変換せずに、変換する予定を表示する")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: imgconv [flags] dir")
+		fmt.Fprintln(fs.Output(), "       imgconv contactsheet [flags] dir")
+		fmt.Fprintln(fs.Output(), "       imgconv dupes [flags] dir")
+		fmt.Fprintln(fs.Output(), "       imgconv assemble [flags] dir")
+		fmt.Fprintln(fs.Output(), "       imgconv diff [flags] a b")
+		fmt.Fprintln(fs.Output(), "       imgconv info [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if c.From, err = imgconv.LookupFormat(*from); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if c.To, err = imgconv.LookupFormat(*to); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if c.To.Encode == nil {
+		fmt.Fprintf(os.Stderr, "imgconv: cannot encode %s\n", c.To.Name)
+		return 2
+	}
+	if c.Encode.JPEGQuality < 1 || c.Encode.JPEGQuality > 100 {
+		fmt.Fprintln(os.Stderr, "imgconv: -quality must be between 1 and 100")
+		return 2
+	}
+	if c.Encode.PNGCompression, err = imgconv.ParseCompression(*compression); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+
+	if c.Ops, err = imgconv.ParseOps(*ops); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if c.Jobs < 1 {
+		fmt.Fprintln(os.Stderr, "imgconv: -j must be at least 1")
+		return 2
+	}
+	if c.Quantize, err = quantize(); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if err := imgconv.ValidateTemplate(c.Template); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+	if c.Overwrite, err = imgconv.ParseOverwritePolicy(*overwrite); err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 2
+	}
+
+	if *dryRun {
+		return plan(&c, fs.Arg(0))
+	}
+
+	// Ctrl+Cで止めたときも、それまでの結果を表示する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := c.ConvertDirContext(ctx, fs.Arg(0))
+	if report == nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	for _, f := range report.Failed {
+		fmt.Fprintln(os.Stderr, "imgconv:", f)
+	}
+	fmt.Printf("converted: %d, skipped: %d, failed: %d\n",
+		len(report.Converted), len(report.Skipped), len(report.Failed))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	if len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// plan は変換する予定を1ファイル1行で表示する。
+func plan(c *imgconv.Converter, root string) int {
+	jobs, err := c.Plan(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "imgconv:", err)
+		return 1
+	}
+	code := 0
+	for _, job := range jobs {
+		switch {
+		case job.Err != nil:
+			fmt.Fprintln(os.Stderr, "imgconv:", &imgconv.Failure{Path: job.Src, Err: job.Err})
+			code = 1
+		case job.Action == imgconv.Skip:
+			fmt.Printf("skip %s (%s exists)\n", job.Src, job.Dst)
+		case c.RemoveOriginals && job.Src != job.Dst:
+			fmt.Printf("%s %s -> %s (remove original)\n", job.Action, job.Src, job.Dst)
+		default:
+			fmt.Printf("%s %s -> %s\n", job.Action, job.Src, job.Dst)
+		}
+	}
+	return code
+}
+
+// quantizeFlags は減色のフラグを fs に加え、解析した設定を返す関数を返す。
+// -colors も固定のパレットも指定しなければ、設定はnilになる。
+func quantizeFlags(fs *flag.FlagSet) func() (*imgconv.Quantization, error) {
+	colors := fs.Int("colors", 0, "減色する色の数 (2-256、0なら減色しない)")
+	method := fs.String("quantizer", "mediancut", "パレットの作り方 (mediancut, octree, plan9, websafe)")
+	dither := fs.String("dither", "fs", "減色するときのディザリング (none, fs, ordered)")
+	return func() (*imgconv.Quantization, error) {
+		q := imgconv.Quantization{Colors: *colors}
+		var err error
+		if q.Method, err = imgconv.ParseQuantizer(*method); err != nil {
+			return nil, err
+		}
+		if q.Dither, err = imgconv.ParseDither(*dither); err != nil {
+			return nil, err
+		}
+		fixed := q.Method == imgconv.Plan9 || q.Method == imgconv.WebSafe
+		switch {
+		case q.Colors == 0 && !fixed:
+			return nil, nil
+		case q.Colors == 0:
+			q.Colors = 256
+		case q.Colors < 2 || q.Colors > 256:
+			return nil, errors.New("-colors must be between 2 and 256")
+		}
+		return &q, nil
+	}
+}
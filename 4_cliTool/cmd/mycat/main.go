@@ -0,0 +1,140 @@
+// mycat はQ1のcatコマンド。
+//
+//	$ mycat -n hoge.txt fuga.txt
+//	1: hoge
+//	2: hoge hoge
+//	3: fuga
+//	4: fugafuga
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"cliTool/cat"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var opts cat.Options
+	flag.BoolVar(&opts.Number, "n", false, "全ての行に行番号を付ける")
+	flag.BoolVar(&opts.NumberNonBlank, "b", false, "空行以外に行番号を付ける(-nより優先)")
+	flag.IntVar(&opts.NumberWidth, "width", 0, "行番号の最小幅")
+	flag.StringVar(&opts.Separator, "sep", cat.DefaultSeparator, "行番号と行の区切り")
+	flag.BoolVar(&opts.SqueezeBlank, "s", false, "連続する空行を1行にまとめる")
+	flag.BoolVar(&opts.ShowEnds, "E", false, "行末に$を表示する")
+	flag.BoolVar(&opts.ShowTabs, "T", false, "タブを^Iで表示する")
+	flag.BoolVar(&opts.ShowNonprinting, "v", false, "制御文字を^とM-記法で表示する")
+	flag.TextVar(&opts.Decompress, "z", cat.NoCompression, "圧縮された入力を展開する (none, auto, gzip, bzip2, zlib)")
+	flag.StringVar(&opts.Encoding, "from-encoding", "", "入力の文字コード (auto, shift_jis, euc-jp, utf-16le など)")
+	flag.BoolVar(&opts.Follow, "f", false, "最後のファイルへの追記を出力し続ける (-z, --from-encodingとは使えない)")
+	flag.BoolVar(&opts.Follow, "follow", false, "-fと同じ")
+	flag.DurationVar(&opts.PollInterval, "poll", cat.DefaultPollInterval, "-fで追記を確認する間隔")
+	lines := flag.String("lines", "", "出力する行の範囲 (10:20, 10:, :20)")
+	head := flag.Int("head", 0, "最初のN行だけを出力する")
+	flag.IntVar(&opts.Select.Tail, "tail", 0, "最後のN行だけを出力する")
+	global := flag.Bool("global", false, "--lines, --head, --tailをファイルごとではなく全体に対して使う")
+	flag.BoolVar(&opts.Recursive, "r", false, "ディレクトリの下のファイルを全て出力する")
+	flag.Var((*patterns)(&opts.Include), "include", "-rで出力するファイル名のパターン (複数指定可)")
+	flag.Var((*patterns)(&opts.Exclude), "exclude", "-rで除外するファイル名のパターン (複数指定可)")
+	flag.BoolVar(&opts.Headers, "headers", false, "各ファイルの前に ==> path <== を表示する")
+	showAll := flag.Bool("A", false, "-vETと同じ")
+	showE := flag.Bool("e", false, "-vEと同じ")
+	showT := flag.Bool("t", false, "-vTと同じ")
+	flag.Parse()
+
+	if *showAll {
+		opts.ShowAll()
+	}
+	if *showE {
+		opts.ShowNonprinting, opts.ShowEnds = true, true
+	}
+	if *showT {
+		opts.ShowNonprinting, opts.ShowTabs = true, true
+	}
+
+	// 追記された内容は展開も文字コードの変換もできないので、組み合わせを受け付けない
+	if opts.Follow && (opts.Decompress != cat.NoCompression || opts.Encoding != "") {
+		fmt.Fprintln(os.Stderr, "mycat: -f cannot be combined with -z or --from-encoding")
+		return 2
+	}
+
+	sel, err := selection(*lines, *head, opts.Select.Tail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mycat:", err)
+		return 2
+	}
+	sel.Global = *global
+	opts.Select = sel
+
+	// -f はCtrl+Cで止めるので、シグナルを受け取ったら正常に終了する
+	ctx := context.Background()
+	if opts.Follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	// ファイルごとのエラーはGNU catと同じく失敗したときに表示する。
+	// それまでの出力より後に表示されるように先に書き出す
+	opts.OnError = func(ferr *cat.FileError) {
+		w.Flush()
+		fmt.Fprintln(os.Stderr, "mycat:", ferr)
+	}
+	err = cat.ConcatContext(ctx, w, opts, flag.Args()...)
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		// ファイルごとのエラーは表示済み
+		var errs cat.Errors
+		if !errors.As(err, &errs) {
+			fmt.Fprintln(os.Stderr, "mycat:", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// patterns は複数回指定できるフラグ。
+type patterns []string
+
+func (ps *patterns) String() string {
+	return strings.Join(*ps, ",")
+}
+
+func (ps *patterns) Set(pattern string) error {
+	*ps = append(*ps, pattern)
+	return nil
+}
+
+// selection は --lines, --head, --tail のうち1つだけを受け付ける。
+func selection(lines string, head, tail int) (cat.Selection, error) {
+	n := 0
+	for _, set := range []bool{lines != "", head != 0, tail != 0} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return cat.Selection{}, errors.New("--lines, --head and --tail cannot be combined")
+	case head < 0 || tail < 0:
+		return cat.Selection{}, errors.New("--head and --tail must be positive")
+	case lines != "":
+		return cat.ParseLines(lines)
+	case head > 0:
+		return cat.Selection{To: head}, nil
+	}
+	return cat.Selection{Tail: tail}, nil
+}
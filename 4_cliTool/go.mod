@@ -1,3 +1,8 @@
 module cliTool
 
 go 1.19
+
+require (
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0
+)
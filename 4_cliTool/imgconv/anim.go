@@ -0,0 +1,325 @@
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Animation はアニメーションGIFの全てのフレーム。
+//
+// GIFのフレームは前のフレームとの差分だけを持つことがあるので、
+// 読み込むときに前のフレームと重ねて、どのフレームも画面全体の画像にする。
+// そのためフレームごとにGrayやResizeをかけても、表示は崩れない。
+type Animation struct {
+	Path      string // 画像のパス。DecodeAnimationで読み込んだ場合は空
+	Frames    []Img  // 各フレーム。どれも同じ大きさ
+	Delays    []int  // 各フレームの表示時間(1/100秒)
+	Disposals []byte // 各フレームを表示した後の処理 (gif.DisposalNone など)
+	LoopCount int    // 繰り返す回数。0は無限、-1は1回だけ表示する
+}
+
+// LoadAnimation は path のGIFの全てのフレームを読み込む。
+// ファイルを開けない場合は*fs.PathErrorを、
+// GIFとして読み込めない場合は*DecodeErrorを返す。
+func LoadAnimation(path string) (*Animation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// 読み込み用なのでCloseのエラーは無視する
+	defer f.Close()
+
+	a, err := DecodeAnimation(f)
+	if err != nil {
+		var de *DecodeError
+		if errors.As(err, &de) {
+			de.Path = path
+		}
+		return nil, err
+	}
+	a.Path = path
+	for i := range a.Frames {
+		a.Frames[i].Path = path
+	}
+	return a, nil
+}
+
+// DecodeAnimation は r からGIFの全てのフレームを読み込む。
+// GIFとして読み込めない場合は*DecodeErrorを返す。
+func DecodeAnimation(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, &DecodeError{Format: "gif", Err: err}
+	}
+	return newAnimation(g), nil
+}
+
+// newAnimation は g のフレームを順に重ねて、画面全体のフレームにする。
+func newAnimation(g *gif.GIF) *Animation {
+	a := &Animation{
+		Delays:    g.Delay,
+		Disposals: g.Disposal,
+		LoopCount: g.LoopCount,
+	}
+	if len(a.Disposals) < len(g.Image) {
+		// Disposalがない古いGIFもある
+		a.Disposals = make([]byte, len(g.Image))
+	}
+
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() && len(g.Image) > 0 {
+		screen = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(screen)
+	var saved *image.RGBA
+	for i, frame := range g.Image {
+		if a.Disposals[i] == gif.DisposalPrevious {
+			saved = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		a.Frames = append(a.Frames, newImg(cloneRGBA(canvas), "", "gif"))
+
+		switch a.Disposals[i] {
+		case gif.DisposalBackground:
+			// 背景色ではなく透明にする。ブラウザもこのように表示する
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	return a
+}
+
+func cloneRGBA(m *image.RGBA) *image.RGBA {
+	c := *m
+	c.Pix = append([]uint8(nil), m.Pix...)
+	return &c
+}
+
+// Apply は全てのフレームに ops を適用したアニメーションを返す。
+// 表示時間などはそのまま保つ。
+func (a *Animation) Apply(ops ...Op) *Animation {
+	out := *a
+	out.Frames = make([]Img, len(a.Frames))
+	for i, frame := range a.Frames {
+		out.Frames[i] = frame.Apply(ops...)
+	}
+	return &out
+}
+
+// Save は path にアニメーションGIFとして書き出す。
+// Img.Saveと同じく、一時ファイルに書き出してから名前を変える。
+// ファイルを作れない場合は*fs.PathErrorを、
+// 書き出しに失敗した場合は*EncodeErrorを返す。
+func (a *Animation) Save(path string) error {
+	return writeFile(path, "gif", a.Encode)
+}
+
+// Encode は w にアニメーションGIFとして書き出す。
+// 各フレームは256色以下ならそのままの色で、そうでなければ減色して書き出す。
+// 失敗した場合は*EncodeErrorを返す。
+func (a *Animation) Encode(w io.Writer) error {
+	if len(a.Frames) == 0 {
+		return &EncodeError{Format: "gif", Err: errors.New("no frames")}
+	}
+	g := &gif.GIF{
+		Delay:     a.Delays,
+		Disposal:  a.Disposals,
+		LoopCount: a.LoopCount,
+	}
+	for _, frame := range a.Frames {
+		g.Image = append(g.Image, paletted(frame.Image))
+	}
+	if err := gif.EncodeAll(w, g); err != nil {
+		return &EncodeError{Format: "gif", Err: err}
+	}
+	return nil
+}
+
+// SaveFrames は dir に各フレームを 000.png, 001.png のような連番のファイルで書き出す。
+// dir がすでにあれば置き換える。
+// 同じ場所の一時ディレクトリに全てのフレームを書き出してから名前を変えるので、
+// 途中で失敗しても dir に書きかけのフレームが残ることはない。
+// 書き出したファイルのパスを返す。
+func (a *Animation) SaveFrames(dir string, format *Format, opts *EncodeOptions) (paths []string, rerr error) {
+	tmp, err := mkdirTemp(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr != nil {
+			os.RemoveAll(tmp)
+		}
+	}()
+
+	digits := len(strconv.Itoa(len(a.Frames) - 1))
+	if digits < 3 {
+		digits = 3
+	}
+	for i, frame := range a.Frames {
+		name := fmt.Sprintf("%0*d%s", digits, i, format.Ext())
+		if err := frame.Save(filepath.Join(tmp, name), opts); err != nil {
+			var ee *EncodeError
+			if errors.As(err, &ee) {
+				ee.Path = filepath.Join(dir, name)
+			}
+			return nil, err
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	if err := replaceDir(tmp, dir); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// mkdirTemp は dir と同じ場所に一時ディレクトリを作る。
+// os.MkdirTempは0700で作るので、os.Mkdirと同じく0777からumaskを除いたパーミッションで作る。
+func mkdirTemp(dir string) (string, error) {
+	for {
+		tmp := tempName(dir)
+		err := os.Mkdir(tmp, 0o777)
+		if !errors.Is(err, fs.ErrExist) {
+			return tmp, err
+		}
+	}
+}
+
+// replaceDir は tmp を dir に名前を変える。
+// ディレクトリは上書きできないので、すでにある dir は別の名前にしてから消す。
+func replaceDir(tmp, dir string) error {
+	if _, err := os.Lstat(dir); err != nil {
+		return os.Rename(tmp, dir)
+	}
+	old := tempName(dir)
+	if err := os.Rename(dir, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		// 元に戻す
+		os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// AssembleFrames は paths の画像を順にフレームにしたアニメーションを作る。
+// 各フレームの表示時間は delay(1/100秒)で、ずっと繰り返す。
+// 大きさが違う画像は、一番大きな画像に合わせた画面の左上に置く。
+func AssembleFrames(paths []string, delay int) (*Animation, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("imgconv: no frames")
+	}
+
+	var imgs []Img
+	var screen image.Rectangle
+	for _, path := range paths {
+		img, err := LoadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+		screen = screen.Union(image.Rect(0, 0, img.Width, img.Height))
+	}
+
+	a := &Animation{}
+	for _, img := range imgs {
+		canvas := image.NewRGBA(screen)
+		draw.Draw(canvas, screen, img.Image, img.Image.Bounds().Min, draw.Src)
+		a.Frames = append(a.Frames, img.with(canvas))
+		a.Delays = append(a.Delays, delay)
+		// 透明な部分に前のフレームが残らないように、毎回消す
+		a.Disposals = append(a.Disposals, gif.DisposalBackground)
+	}
+	return a, nil
+}
+
+// AssembleDir は dir の直下の画像をファイル名の順にフレームにしたアニメーションを作る。
+// 連番のファイル名は 001.png のように桁をそろえる必要がある。
+func AssembleDir(dir string, delay int) (*Animation, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if _, ferr := FormatOf(e.Name()); ferr == nil && !e.IsDir() {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	return AssembleFrames(paths, delay)
+}
+
+// paletted は m をGIFで書き出せるパレット画像にする。
+// 使われている色が256色以下ならその色をそのままパレットにし、
+// そうでなければメディアンカットで作ったパレットに誤差拡散で減色する。
+// 半分以上透明な画素は透明にする。
+func paletted(m image.Image) *image.Paletted {
+	src := toRGBA(m)
+	b := src.Bounds()
+
+	if pal, ok := exactPalette(src); ok {
+		dst := image.NewPaletted(b, pal)
+		index := make(map[color.RGBA]uint8, len(pal))
+		for i, c := range pal {
+			index[c.(color.RGBA)] = uint8(i)
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				dst.SetColorIndex(x, y, index[opaqueOrClear(src.RGBAAt(x, y))])
+			}
+		}
+		return dst
+	}
+
+	q := newImg(src, "", "").Quantize(Quantization{Colors: 256, Dither: FloydSteinberg})
+	return q.Image.(*image.Paletted)
+}
+
+// exactPalette は m の色が256色以下ならその色のパレットを返す。
+func exactPalette(m *image.RGBA) (color.Palette, bool) {
+	seen := make(map[color.RGBA]bool)
+	var pal color.Palette
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := opaqueOrClear(m.RGBAAt(x, y))
+			if seen[c] {
+				continue
+			}
+			if len(pal) == 256 {
+				return nil, false
+			}
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	return pal, true
+}
+
+// opaqueOrClear はGIFに半透明がないので、c を不透明か透明にする。
+func opaqueOrClear(c color.RGBA) color.RGBA {
+	if c.A < 0x80 {
+		return color.RGBA{}
+	}
+	if c.A == 0xff {
+		return c
+	}
+	// 乗算済みの値を戻す
+	return color.RGBA{
+		R: uint8(uint16(c.R) * 0xff / uint16(c.A)),
+		G: uint8(uint16(c.G) * 0xff / uint16(c.A)),
+		B: uint8(uint16(c.B) * 0xff / uint16(c.A)),
+		A: 0xff,
+	}
+}
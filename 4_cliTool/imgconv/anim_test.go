@@ -0,0 +1,161 @@
+package imgconv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{0xff, 0, 0, 0xff}
+	green = color.RGBA{0, 0xff, 0, 0xff}
+	blue  = color.RGBA{0, 0, 0xff, 0xff}
+)
+
+// testGIF は4x4の画面に3枚のフレームを持つGIFを作る。
+//
+//	0: 画面全体が赤。表示した後は前の状態(何もない)に戻す
+//	1: 左上の2x2が緑。表示した後は背景(透明)にする
+//	2: 右下の2x2が青
+func testGIF(t *testing.T) []byte {
+	t.Helper()
+	pal := color.Palette{color.RGBA{}, red, green, blue}
+	frame := func(r image.Rectangle, index uint8) *image.Paletted {
+		m := image.NewPaletted(r, pal)
+		for i := range m.Pix {
+			m.Pix[i] = index
+		}
+		return m
+	}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			frame(image.Rect(0, 0, 4, 4), 1),
+			frame(image.Rect(0, 0, 2, 2), 2),
+			frame(image.Rect(2, 2, 4, 4), 3),
+		},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalPrevious, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{ColorModel: pal, Width: 4, Height: 4},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 各フレームは前のフレームと重ねた画面全体の画像になる。
+func TestDecodeAnimation(t *testing.T) {
+	a, err := DecodeAnimation(bytes.NewReader(testGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	none := color.RGBA{}
+	for _, tt := range []struct {
+		frame int
+		pt    image.Point
+		want  color.RGBA
+	}{
+		{0, image.Pt(0, 0), red},
+		{0, image.Pt(3, 3), red},
+		// 0枚目は消えて、何もない状態に戻っている
+		{1, image.Pt(0, 0), green},
+		{1, image.Pt(3, 3), none},
+		// 1枚目は透明になっている
+		{2, image.Pt(0, 0), none},
+		{2, image.Pt(3, 0), none},
+		{2, image.Pt(3, 3), blue},
+	} {
+		m := a.Frames[tt.frame].Image
+		if m.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Fatalf("frame %d: Bounds() = %v", tt.frame, m.Bounds())
+		}
+		if got := color.RGBAModel.Convert(m.At(tt.pt.X, tt.pt.Y)); got != tt.want {
+			t.Errorf("frame %d at %v = %v, want %v", tt.frame, tt.pt, got, tt.want)
+		}
+	}
+}
+
+// GrayとResizeをかけても、フレームの数や表示時間などはそのまま残る。
+func TestConvertAnimation(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.gif"), filepath.Join(dir, "b.gif")
+	if err := os.WriteFile(src, testGIF(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ops, err := ParseOps("resize=8x0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifFormat := mustFormat(t, "gif")
+	c := &Converter{From: gifFormat, To: gifFormat, Gray: true, Ops: ops}
+	if err := c.Convert(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("%d frames, want 3", len(g.Image))
+	}
+	if g.Config.Width != 8 || g.Config.Height != 8 {
+		t.Errorf("size = %dx%d, want 8x8", g.Config.Width, g.Config.Height)
+	}
+	if want := []int{10, 20, 30}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("Delay = %v, want %v", g.Delay, want)
+	}
+	if want := []byte{gif.DisposalPrevious, gif.DisposalBackground, gif.DisposalNone}; !reflect.DeepEqual(g.Disposal, want) {
+		t.Errorf("Disposal = %v, want %v", g.Disposal, want)
+	}
+	if g.LoopCount != 3 {
+		t.Errorf("LoopCount = %d, want 3", g.LoopCount)
+	}
+}
+
+// SaveFramesはすでにあるディレクトリを丸ごと置き換える。
+func TestSaveFramesReplace(t *testing.T) {
+	a, err := DecodeAnimation(bytes.NewReader(testGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "a")
+	for _, name := range []string{"000.png", "003.png", "notes.txt", "sub/004.png"} {
+		touch(t, filepath.Join(dir, name))
+	}
+
+	paths, err := a.SaveFrames(dir, mustFormat(t, "png"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"000.png", "001.png", "002.png"}
+	for i, p := range paths {
+		if p != filepath.Join(dir, want[i]) {
+			t.Errorf("paths[%d] = %s, want %s", i, p, filepath.Join(dir, want[i]))
+		}
+	}
+	assertDir(t, dir, want...)
+	// 一時ディレクトリも残らない
+	assertDir(t, parent, "a")
+
+	img, err := LoadImage(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.Image.At(3, 3)); got != blue {
+		t.Errorf("002.png at (3, 3) = %v, want %v", got, blue)
+	}
+}
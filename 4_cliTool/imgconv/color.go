@@ -0,0 +1,35 @@
+package imgconv
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/colornames"
+)
+
+// ParseColor は "#rrggbb", "#rrggbbaa" またはSVGの色の名前("white" など)を解析する。
+func ParseColor(s string) (color.Color, error) {
+	if !strings.HasPrefix(s, "#") {
+		c, ok := colornames.Map[strings.ToLower(s)]
+		if !ok {
+			return nil, fmt.Errorf("unknown color %q", s)
+		}
+		return c, nil
+	}
+
+	hex := s[1:]
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	// color.RGBAは乗算済みなので、不透明でない色はNRGBAで返す
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,139 @@
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// ContactSheet はディレクトリの画像のサムネイルを格子状に並べた一覧画像を作る。
+type ContactSheet struct {
+	Columns    int           // 1行に並べる数。0なら4
+	ThumbSize  int           // サムネイルの幅と高さの最大。0なら160
+	Padding    int           // サムネイルの間と周りの余白
+	Background color.Color   // 背景色。nilなら白
+	Labels     bool          // サムネイルの下にファイル名を描く
+	Resize     Interpolation // 縮小の補間方法
+}
+
+// labelFace はファイル名を描くフォント。ASCII以外の文字は描けない。
+var labelFace = basicfont.Face7x13
+
+// BuildDir は root 以下の画像から一覧画像を作る。
+// 読み込めない画像は飛ばし、その理由を返す。
+// 画像が1枚もなければエラーを返す。
+func (cs *ContactSheet) BuildDir(root string) (Img, []*Failure, error) {
+	paths, failures, err := imageFiles(root)
+	if err != nil {
+		return Img{}, nil, err
+	}
+
+	img, more, err := cs.Build(paths)
+	return img, append(failures, more...), err
+}
+
+// Build は paths の画像を順に並べた一覧画像を作る。
+// 画像は1枚ずつ読み込んで縮小するので、大きな画像がたくさんあってもメモリを使いすぎない。
+func (cs *ContactSheet) Build(paths []string) (Img, []*Failure, error) {
+	cols, size, pad := cs.Columns, cs.ThumbSize, cs.Padding
+	if cols <= 0 {
+		cols = 4
+	}
+	if size <= 0 {
+		size = 160
+	}
+	if pad < 0 {
+		pad = 0
+	}
+	var bg color.Color = color.White
+	if cs.Background != nil {
+		bg = cs.Background
+	}
+
+	var thumbs []Img
+	var names []string
+	var failures []*Failure
+	for _, path := range paths {
+		img, err := LoadImage(path)
+		if err != nil {
+			failures = append(failures, &Failure{Path: path, Err: err})
+			continue
+		}
+		thumbs = append(thumbs, img.fit(size, cs.Resize))
+		names = append(names, filepath.Base(path))
+	}
+	if len(thumbs) == 0 {
+		return Img{}, failures, errors.New("imgconv: no images for contact sheet")
+	}
+
+	if cols > len(thumbs) {
+		cols = len(thumbs)
+	}
+	rows := (len(thumbs) + cols - 1) / cols
+	labelHeight := 0
+	if cs.Labels {
+		labelHeight = labelFace.Metrics().Height.Ceil() + pad/2
+	}
+	cellW, cellH := size, size+labelHeight
+
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*(cellW+pad)+pad, rows*(cellH+pad)+pad))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	for i, thumb := range thumbs {
+		cell := image.Pt(pad+(i%cols)*(cellW+pad), pad+(i/cols)*(cellH+pad))
+		// セルの中央に置く
+		at := cell.Add(image.Pt((size-thumb.Width)/2, (size-thumb.Height)/2))
+		r := image.Rectangle{Min: at, Max: at.Add(image.Pt(thumb.Width, thumb.Height))}
+		draw.Draw(sheet, r, thumb.Image, thumb.Image.Bounds().Min, draw.Over)
+
+		if cs.Labels {
+			drawLabel(sheet, names[i], cell.Add(image.Pt(0, size+pad/2)), cellW, textColor(bg))
+		}
+	}
+	return newImg(sheet, "", ""), failures, nil
+}
+
+// fit は縦横比を保って size × size に収まるように縮小する。
+// 元から収まる場合は拡大しない。
+func (img Img) fit(size int, algo Interpolation) Img {
+	if img.Width <= size && img.Height <= size {
+		return img
+	}
+	if img.Width >= img.Height {
+		return img.Resize(size, 0, algo)
+	}
+	return img.Resize(0, size, algo)
+}
+
+// drawLabel は top を上端として幅 width の中央に text を描く。
+// 入りきらない場合は末尾を "..." にする。
+func drawLabel(dst draw.Image, text string, top image.Point, width int, c color.Color) {
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: labelFace}
+	max := fixed.I(width)
+	if d.MeasureString(text) > max {
+		runes := []rune(text)
+		for len(runes) > 0 && d.MeasureString(string(runes)+"...") > max {
+			runes = runes[:len(runes)-1]
+		}
+		text = string(runes) + "..."
+	}
+
+	x := top.X + (width-d.MeasureString(text).Ceil())/2
+	y := top.Y + labelFace.Metrics().Ascent.Ceil()
+	d.Dot = fixed.P(x, y)
+	d.DrawString(text)
+}
+
+// textColor は背景が明るければ黒、暗ければ白を返す。
+func textColor(bg color.Color) color.Color {
+	if color.GrayModel.Convert(bg).(color.Gray).Y >= 128 {
+		return color.Black
+	}
+	return color.White
+}
@@ -0,0 +1,425 @@
+package imgconv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Converter はディレクトリ以下の画像を一括で変換する。
+type Converter struct {
+	From, To *Format       // 変換前と変換後の画像形式
+	Decode   DecodeOptions // 読み込むときの設定
+	Encode   EncodeOptions // 書き出すときの設定
+	OutDir   string        // 出力先。空なら元のファイルと同じディレクトリ
+	Gray     bool          // グレースケールにする
+	Ops      []Op          // Grayの後に順に適用する変換
+	Jobs     int           // 同時に変換するファイルの数。0なら1
+	Quantize *Quantization // Opsの後に減色する。nilなら減色しない
+	// GIFをGIF以外に変換するとき、全てのフレームを連番のファイルで書き出す。
+	// 出力先は拡張子を除いたディレクトリになる。1枚だけのGIFも同じ。
+	// falseならアニメーションGIFは最初のフレームだけを変換する
+	Frames bool
+
+	// 出力先のファイル名のテンプレート。空なら "{dir}/{name}.{ext}"。
+	// {dir}は出力先のディレクトリ、{name}は拡張子を除いたファイル名、{ext}はToの拡張子
+	Template        string
+	Overwrite       OverwritePolicy // 出力先がすでにあるときの扱い
+	RemoveOriginals bool            // 変換できた元のファイルを消す
+}
+
+// OverwritePolicy は出力先がすでにあるときの扱い。
+// 同じ実行の中で出力先が重なった場合は、Overwriteでも上書きしない。
+type OverwritePolicy int
+
+const (
+	SkipExisting OverwritePolicy = iota // 変換しない
+	Overwrite                           // 上書きする
+	Rename                              // name_1.png のように番号を付けた名前で書き出す
+)
+
+var overwriteNames = [...]string{
+	SkipExisting: "skip",
+	Overwrite:    "overwrite",
+	Rename:       "rename",
+}
+
+func (p OverwritePolicy) String() string {
+	if p < 0 || int(p) >= len(overwriteNames) {
+		return fmt.Sprintf("OverwritePolicy(%d)", int(p))
+	}
+	return overwriteNames[p]
+}
+
+// ParseOverwritePolicy は "skip", "overwrite", "rename" を解析する。
+func ParseOverwritePolicy(name string) (OverwritePolicy, error) {
+	for p, n := range overwriteNames {
+		if n == name {
+			return OverwritePolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overwrite policy %q", name)
+}
+
+// Report は一括変換の結果。
+type Report struct {
+	Converted []string   // 変換したファイル
+	Skipped   []string   // 出力先がすでにあったので変換しなかったファイル
+	Failed    []*Failure // 変換に失敗したファイル
+}
+
+// Failure は変換に失敗したファイルとその理由。
+type Failure struct {
+	Path string
+	Err  error
+}
+
+func (f *Failure) Error() string {
+	// パスが重複しないようにする
+	if hasPath(f.Err) {
+		return f.Err.Error()
+	}
+	return f.Path + ": " + f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// ConvertDir は root 以下の画像を全て変換する。
+// 1つのファイルの変換に失敗しても残りのファイルは変換を続け、
+// 失敗したファイルはReport.Failedに入れる。
+func (c *Converter) ConvertDir(root string) (*Report, error) {
+	return c.ConvertDirContext(context.Background(), root)
+}
+
+// ConvertDirContext はConvertDirと同じだが、ctx が終わると新しいファイルの変換を始めずに
+// それまでの結果とctx.Err()を返す。
+// Reportの各リストは並行に変換してもディレクトリをたどった順に並ぶ。
+func (c *Converter) ConvertDirContext(ctx context.Context, root string) (*Report, error) {
+	jobs, err := c.Plan(root)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*task, len(jobs))
+	for i, job := range jobs {
+		tasks[i] = &task{Job: job}
+		switch {
+		case job.Err != nil:
+			tasks[i].result, tasks[i].err = failed, job.Err
+		case job.Action == Skip:
+			tasks[i].result = skipped
+		}
+	}
+	c.run(ctx, tasks)
+
+	report := &Report{}
+	for _, t := range tasks {
+		switch t.result {
+		case converted:
+			report.Converted = append(report.Converted, t.Src)
+		case skipped:
+			report.Skipped = append(report.Skipped, t.Src)
+		case failed:
+			report.fail(t.Src, t.err)
+		}
+	}
+	return report, ctx.Err()
+}
+
+type result int
+
+const (
+	pending result = iota // まだ変換していない
+	converted
+	skipped
+	failed
+)
+
+// Action はJobで行う処理。
+type Action int
+
+const (
+	Create  Action = iota // 新しく書き出す
+	Skip                  // 出力先がすでにあるので変換しない
+	Replace               // 出力先を上書きする
+	Renamed               // 出力先がすでにあるので、番号を付けたDstに書き出す
+)
+
+var actionNames = [...]string{
+	Create:  "create",
+	Skip:    "skip",
+	Replace: "overwrite",
+	Renamed: "rename",
+}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// Job は1つのファイルの変換の予定。
+type Job struct {
+	Src, Dst string
+	Action   Action
+	Err      error // 出力先を決められなかった理由。nilでなければ変換しない
+}
+
+// task は1つのファイルの変換。
+type task struct {
+	*Job
+	result result
+	err    error
+}
+
+// Plan は root 以下をたどって、ConvertDirで変換するファイルとその出力先を決める。
+// ファイルは書き出さないので、変換する前の確認に使える。
+func (c *Converter) Plan(root string) ([]*Job, error) {
+	if c.From == nil || c.To == nil {
+		return nil, errors.New("imgconv: From and To must be set")
+	}
+
+	var jobs []*Job
+	// 拡張子の大文字と小文字の違いやテンプレートによって、出力先が重なることがある
+	outputs := make(map[string]bool)
+	exists := func(path string) bool {
+		if outputs[path] {
+			return true
+		}
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			jobs = append(jobs, &Job{Src: path, Err: err})
+			return nil
+		}
+		if info.IsDir() || !c.match(path) {
+			return nil
+		}
+
+		job := &Job{Src: path}
+		jobs = append(jobs, job)
+		if job.Dst, job.Err = c.Output(root, path); job.Err != nil {
+			return nil
+		}
+		switch {
+		case !exists(job.Dst):
+		case outputs[job.Dst] && c.Overwrite != Rename:
+			job.Action = Skip
+		case c.Overwrite == SkipExisting:
+			job.Action = Skip
+		case c.Overwrite == Overwrite:
+			job.Action = Replace
+		case c.Overwrite == Rename:
+			job.Action = Renamed
+			ext := filepath.Ext(job.Dst)
+			base := strings.TrimSuffix(job.Dst, ext)
+			for i := 1; exists(job.Dst); i++ {
+				job.Dst = fmt.Sprintf("%s_%d%s", base, i, ext)
+			}
+		}
+		if job.Action != Skip {
+			outputs[job.Dst] = true
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// run は tasks のうちまだ変換していないものを、Jobsの数のgoroutineで変換する。
+func (c *Converter) run(ctx context.Context, tasks []*task) {
+	var todo []*task
+	for _, t := range tasks {
+		if t.result == pending {
+			todo = append(todo, t)
+		}
+	}
+	forEach(ctx, len(todo), c.Jobs, func(i int) {
+		c.runTask(todo[i])
+	})
+}
+
+func (c *Converter) runTask(t *task) {
+	if err := c.Convert(t.Src, t.Dst); err != nil {
+		t.result, t.err = failed, err
+		return
+	}
+	// 同じファイルに上書きした場合は消さない
+	if c.RemoveOriginals && !sameFile(t.Src, t.Dst) {
+		if err := os.Remove(t.Src); err != nil {
+			t.result, t.err = failed, err
+			return
+		}
+	}
+	t.result = converted
+}
+
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
+
+// Convert は src の画像を変換して dst に書き出す。
+// アニメーションGIFはフレームごとに変換する。
+// Framesの場合、dst はフレームを書き出すディレクトリ。
+func (c *Converter) Convert(src, dst string) error {
+	if c.frames() || c.From.Name == "gif" && c.To.Name == "gif" {
+		a, err := LoadAnimation(src)
+		if err != nil {
+			return err
+		}
+		// 1枚だけのGIFはパレットを保つために普通の画像として読み直す
+		if c.frames() || len(a.Frames) > 1 {
+			return c.convertAnimation(a, dst)
+		}
+	}
+
+	img, err := LoadImageWith(src, &c.Decode)
+	if err != nil {
+		return err
+	}
+	if c.Gray {
+		img = img.Gray()
+	}
+	img = img.Apply(c.Ops...)
+	if c.Quantize != nil {
+		img = img.Quantize(*c.Quantize)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return img.Save(dst, &c.Encode)
+}
+
+func (c *Converter) convertAnimation(a *Animation, dst string) error {
+	if c.Gray {
+		a = a.Apply(Img.Gray)
+	}
+	a = a.Apply(c.Ops...)
+	if c.Quantize != nil {
+		a = a.Apply(func(img Img) Img { return img.Quantize(*c.Quantize) })
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if c.To.Name == "gif" {
+		return a.Save(dst)
+	}
+	_, err := a.SaveFrames(dst, c.To, &c.Encode)
+	return err
+}
+
+// frames はGIFのフレームを連番のファイルにするかを返す。
+func (c *Converter) frames() bool {
+	return c.Frames && c.From.Name == "gif" && c.To.Name != "gif"
+}
+
+// match は path が変換するファイルかを返す。
+func (c *Converter) match(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range c.From.Exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// imageFiles は root 以下の、拡張子から画像形式がわかるファイルを集める。
+// たどれなかったパスはFailureとして返す。
+func imageFiles(root string) ([]string, []*Failure, error) {
+	var paths []string
+	var failures []*Failure
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			failures = append(failures, &Failure{Path: path, Err: err})
+			return nil
+		}
+		if _, ferr := FormatOf(path); ferr == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, failures, err
+}
+
+// Output は root 以下の path を変換したときの出力先をTemplateから作る。
+// {dir}は path のディレクトリで、OutDirを指定した場合は root からの相対パスを保つ。
+// Framesの場合は拡張子を除いたディレクトリを返す。
+func (c *Converter) Output(root, path string) (string, error) {
+	dir := filepath.Dir(path)
+	if c.OutDir != "" {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(c.OutDir, rel)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	tmpl := c.Template
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	out, err := expandTemplate(tmpl, map[string]string{
+		"dir":  dir,
+		"name": name,
+		"ext":  strings.TrimPrefix(c.To.Ext(), "."),
+	})
+	if err != nil {
+		return "", err
+	}
+	if c.frames() {
+		out = strings.TrimSuffix(out, filepath.Ext(out))
+	}
+	return filepath.Clean(out), nil
+}
+
+// DefaultTemplate は元のファイルと同じ名前で拡張子だけを変える出力先のテンプレート。
+const DefaultTemplate = "{dir}/{name}.{ext}"
+
+// ValidateTemplate は出力先のテンプレートに知らない {...} がないかを確かめる。
+func ValidateTemplate(tmpl string) error {
+	_, err := expandTemplate(tmpl, map[string]string{"dir": "", "name": "", "ext": ""})
+	return err
+}
+
+// expandTemplate は tmpl の {key} を vars の値に置き換える。
+func expandTemplate(tmpl string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			b.WriteString(tmpl)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("invalid template: missing } in %q", tmpl)
+		}
+		key := tmpl[i+1 : i+j]
+		v, ok := vars[key]
+		if !ok {
+			return "", fmt.Errorf("invalid template: unknown {%s}", key)
+		}
+		b.WriteString(tmpl[:i])
+		b.WriteString(v)
+		tmpl = tmpl[i+j+1:]
+	}
+}
+
+func (r *Report) fail(path string, err error) {
+	r.Failed = append(r.Failed, &Failure{Path: path, Err: err})
+}
@@ -0,0 +1,210 @@
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for _, p := range []OverwritePolicy{SkipExisting, Overwrite, Rename} {
+		got, err := ParseOverwritePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseOverwritePolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseOverwritePolicy("replace"); err == nil {
+		t.Error("ParseOverwritePolicy(\"replace\") succeeded")
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]string{"dir": "out/sub", "name": "a", "ext": "jpg"}
+	for _, tt := range []struct {
+		tmpl, want string
+		ok         bool
+	}{
+		{DefaultTemplate, "out/sub/a.jpg", true},
+		{"{dir}/{name}_gray.{ext}", "out/sub/a_gray.jpg", true},
+		{"{name}{name}.{ext}", "aa.jpg", true},
+		{"fixed.png", "fixed.png", true},
+		{"{dir}/{base}.{ext}", "", false},
+		{"{dir}/{name.{ext}", "", false},
+		{"{dir}/{name", "", false},
+	} {
+		got, err := expandTemplate(tt.tmpl, vars)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, %v, want %q", tt.tmpl, got, err, tt.want)
+		}
+		if err := ValidateTemplate(tt.tmpl); (err == nil) != tt.ok {
+			t.Errorf("ValidateTemplate(%q) = %v", tt.tmpl, err)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	png, jpeg := mustFormat(t, "png"), mustFormat(t, "jpeg")
+
+	// a.jpgとb.jpg、b_1.jpgはすでにある。d.pngとd.PNGはどちらもd.jpgになる
+	files := []string{"a.png", "a.jpg", "b.png", "b.jpg", "b_1.jpg", "d.png", "d.PNG", "sub/c.png"}
+
+	type want struct {
+		src, dst string
+		action   Action
+	}
+	for _, tt := range []struct {
+		name     string
+		policy   OverwritePolicy
+		template string
+		want     []want
+	}{
+		{"skip", SkipExisting, "", []want{
+			{"a.png", "a.jpg", Skip},
+			{"b.png", "b.jpg", Skip},
+			{"d.PNG", "d.jpg", Create},
+			{"d.png", "d.jpg", Skip},
+			{"sub/c.png", "sub/c.jpg", Create},
+		}},
+		{"overwrite", Overwrite, "", []want{
+			{"a.png", "a.jpg", Replace},
+			{"b.png", "b.jpg", Replace},
+			{"d.PNG", "d.jpg", Create},
+			{"d.png", "d.jpg", Skip},
+			{"sub/c.png", "sub/c.jpg", Create},
+		}},
+		{"rename", Rename, "", []want{
+			{"a.png", "a_1.jpg", Renamed},
+			{"b.png", "b_2.jpg", Renamed},
+			{"d.PNG", "d.jpg", Create},
+			{"d.png", "d_1.jpg", Renamed},
+			{"sub/c.png", "sub/c.jpg", Create},
+		}},
+		{"template", SkipExisting, "{dir}/{name}_gray.{ext}", []want{
+			{"a.png", "a_gray.jpg", Create},
+			{"b.png", "b_gray.jpg", Create},
+			{"d.PNG", "d_gray.jpg", Create},
+			{"d.png", "d_gray.jpg", Skip},
+			{"sub/c.png", "sub/c_gray.jpg", Create},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, f := range files {
+				touch(t, filepath.Join(root, f))
+			}
+			c := &Converter{From: png, To: jpeg, Overwrite: tt.policy, Template: tt.template}
+			jobs, err := c.Plan(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []want
+			for _, j := range jobs {
+				if j.Err != nil {
+					t.Fatalf("%s: %v", j.Src, j.Err)
+				}
+				src, _ := filepath.Rel(root, j.Src)
+				dst, _ := filepath.Rel(root, j.Dst)
+				got = append(got, want{filepath.ToSlash(src), filepath.ToSlash(dst), j.Action})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() =\n%v\nwant\n%v", got, tt.want)
+			}
+
+			// Planはファイルを書き出さない
+			for _, f := range []string{"a_1.jpg", "d_gray.jpg", "sub/c.jpg"} {
+				if _, err := os.Stat(filepath.Join(root, f)); err == nil {
+					t.Errorf("Plan() created %s", f)
+				}
+			}
+		})
+	}
+}
+
+// 同じファイルに上書きするときは、RemoveOriginalsでも書き出したファイルを消さない。
+func TestConvertDirInPlace(t *testing.T) {
+	png := mustFormat(t, "png")
+	root := t.TempDir()
+	path := filepath.Join(root, "a.png")
+	if err := newImg(randomRGBA(image.Rect(0, 0, 8, 8)), "", "").Save(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Converter{From: png, To: png, Gray: true, Overwrite: Overwrite, RemoveOriginals: true}
+	report, err := c.ConvertDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Converted) != 1 || len(report.Failed) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	img, err := LoadImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.Image.(*image.Gray); !ok {
+		t.Errorf("%s is %T, want *image.Gray", path, img.Image)
+	}
+	assertDir(t, root, "a.png")
+}
+
+// 書き出しに失敗しても一時ファイルは残らず、元のファイルもそのまま。
+func TestSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.gif")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// GIFは幅が65535を超える画像を書き出せない
+	img := newImg(image.NewGray(image.Rect(0, 0, 1<<16, 1)), "", "")
+	err := img.Save(path, nil)
+	var ee *EncodeError
+	if !errors.As(err, &ee) || ee.Path != path {
+		t.Fatalf("Save() = %v, want *EncodeError for %s", err, path)
+	}
+
+	assertDir(t, dir, "x.gif")
+	if b, _ := os.ReadFile(path); string(b) != "old" {
+		t.Errorf("%s = %q, want %q", path, b, "old")
+	}
+}
+
+func mustFormat(t *testing.T, name string) *Format {
+	t.Helper()
+	f, err := LookupFormat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// touch は中身が空のファイルを作る。途中のディレクトリも作る。
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertDir は dir にあるのが names だけであることを確かめる。
+func assertDir(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if !reflect.DeepEqual(got, names) {
+		t.Errorf("%s contains %q, want %q", dir, got, names)
+	}
+}
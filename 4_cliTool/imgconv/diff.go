@@ -0,0 +1,121 @@
+package imgconv
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// DiffResult は同じ大きさの2枚の画像を比べた結果。
+type DiffResult struct {
+	Size      image.Point // 画像の大きさ
+	Pixels    int         // 画素の数
+	Differing int         // 違う画素の数
+	PSNR      float64     // RGBのPSNR(dB)。同じならInf
+	SSIM      float64     // 輝度のSSIM。1なら同じ
+	Map       Img         // 違う画素を赤くした画像。同じ画素は薄い灰色にする
+}
+
+// Percent は違う画素の割合(%)を返す。
+func (r *DiffResult) Percent() float64 {
+	if r.Pixels == 0 {
+		return 0
+	}
+	return float64(r.Differing) * 100 / float64(r.Pixels)
+}
+
+// Diff は a と b を画素ごとに比べる。
+// RGBAのどのチャンネルも差が tolerance 以下なら同じ画素とみなす。
+// 左上が(0, 0)でなくても、それぞれの左上をそろえて比べる。
+// 大きさが違う場合は*SizeMismatchErrorを返す。
+func Diff(a, b Img, tolerance int) (*DiffResult, error) {
+	ra, rb := toRGBA(a.Image), toRGBA(b.Image)
+	if ra.Rect.Size() != rb.Rect.Size() {
+		return nil, &SizeMismatchError{A: ra.Rect.Size(), B: rb.Rect.Size()}
+	}
+	bounds := ra.Rect
+	r := &DiffResult{Size: bounds.Size(), Pixels: bounds.Dx() * bounds.Dy()}
+
+	diffMap := image.NewNRGBA(bounds)
+	var sq float64 // RGBの差の2乗の合計
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca, cb := ra.Pix[ra.PixOffset(x, y):][:4], rb.Pix[rb.PixOffset(x, y):][:4]
+			same := true
+			for i := range ca {
+				d := int(ca[i]) - int(cb[i])
+				if i < 3 {
+					sq += float64(d * d)
+				}
+				if d > tolerance || -d > tolerance {
+					same = false
+				}
+			}
+			if same {
+				// 元の画像がわかるように、輝度を薄くして残す
+				g := luma(uint32(ca[0])*0x101, uint32(ca[1])*0x101, uint32(ca[2])*0x101)/4 + 192
+				diffMap.SetNRGBA(x, y, color.NRGBA{g, g, g, 0xff})
+			} else {
+				r.Differing++
+				diffMap.SetNRGBA(x, y, diffColor)
+			}
+		}
+	}
+
+	r.PSNR = math.Inf(1)
+	if n := r.Pixels * 3; n > 0 && sq > 0 {
+		r.PSNR = 10 * math.Log10(255*255/(sq/float64(n)))
+	}
+	r.SSIM = ssim(newImg(ra, "", "").Gray().Image.(*image.Gray), newImg(rb, "", "").Gray().Image.(*image.Gray))
+	r.Map = newImg(diffMap, "", "")
+	return r, nil
+}
+
+var diffColor = color.NRGBA{0xff, 0, 0, 0xff}
+
+// ssim は8×8の窓を4画素ずつずらして求めたSSIMの平均を返す。
+// 窓より小さい画像は全体を1つの窓にする。
+func ssim(a, b *image.Gray) float64 {
+	const (
+		size = 8
+		step = 4
+		c1   = (0.01 * 255) * (0.01 * 255)
+		c2   = (0.03 * 255) * (0.03 * 255)
+	)
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	if w == 0 || h == 0 {
+		return 1
+	}
+	ww, wh := size, size
+	if w < ww {
+		ww = w
+	}
+	if h < wh {
+		wh = h
+	}
+
+	total, windows := 0.0, 0
+	for y0 := 0; y0+wh <= h; y0 += step {
+		for x0 := 0; x0+ww <= w; x0 += step {
+			var sa, sb, saa, sbb, sab float64
+			for y := y0; y < y0+wh; y++ {
+				pa, pb := a.Pix[a.PixOffset(x0, y):][:ww], b.Pix[b.PixOffset(x0, y):][:ww]
+				for i := range pa {
+					va, vb := float64(pa[i]), float64(pb[i])
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+			n := float64(ww * wh)
+			ma, mb := sa/n, sb/n
+			va, vb := saa/n-ma*ma, sbb/n-mb*mb
+			cov := sab/n - ma*mb
+			total += (2*ma*mb + c1) * (2*cov + c2) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
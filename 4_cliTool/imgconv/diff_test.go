@@ -0,0 +1,105 @@
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestDiffIdentical(t *testing.T) {
+	m := randomRGBA(image.Rect(0, 0, 20, 12))
+	r, err := Diff(newImg(m, "", ""), newImg(cloneRGBA(m), "", ""), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Differing != 0 || r.Pixels != 20*12 {
+		t.Errorf("Differing, Pixels = %d, %d, want 0, %d", r.Differing, r.Pixels, 20*12)
+	}
+	if !math.IsInf(r.PSNR, 1) {
+		t.Errorf("PSNR = %v, want +Inf", r.PSNR)
+	}
+	if math.Abs(r.SSIM-1) > 1e-9 {
+		t.Errorf("SSIM = %v, want 1", r.SSIM)
+	}
+}
+
+func TestDiffSizeMismatch(t *testing.T) {
+	a := newImg(image.NewRGBA(image.Rect(0, 0, 4, 3)), "", "")
+	b := newImg(image.NewRGBA(image.Rect(0, 0, 3, 4)), "", "")
+	_, err := Diff(a, b, 0)
+	var se *SizeMismatchError
+	if !errors.As(err, &se) {
+		t.Fatalf("Diff() = %v, want *SizeMismatchError", err)
+	}
+	if se.A != image.Pt(4, 3) || se.B != image.Pt(3, 4) {
+		t.Errorf("sizes = %v, %v, want (4,3), (3,4)", se.A, se.B)
+	}
+}
+
+// 1つの画素の差が tolerance 以下なら同じ、超えたら違う画素になる。
+func TestDiffTolerance(t *testing.T) {
+	const tolerance = 10
+	base := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(base, base.Rect, image.NewUniform(color.RGBA{100, 100, 100, 0xff}), image.Point{}, draw.Src)
+
+	for _, tt := range []struct {
+		delta     uint8
+		differing int
+	}{
+		{tolerance - 1, 0},
+		{tolerance, 0},
+		{tolerance + 1, 1},
+		{50, 1},
+	} {
+		changed := cloneRGBA(base)
+		changed.SetRGBA(3, 5, color.RGBA{100, 100 + tt.delta, 100, 0xff})
+		r, err := Diff(newImg(base, "", ""), newImg(changed, "", ""), tolerance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Differing != tt.differing {
+			t.Errorf("delta %d: Differing = %d, want %d", tt.delta, r.Differing, tt.differing)
+		}
+		// 差がある限り、PSNRは有限でSSIMは1より小さい
+		if math.IsInf(r.PSNR, 0) || r.SSIM >= 1 {
+			t.Errorf("delta %d: PSNR, SSIM = %v, %v", tt.delta, r.PSNR, r.SSIM)
+		}
+		isRed := r.Map.Image.At(3, 5) == color.Color(diffColor)
+		if isRed != (tt.differing == 1) {
+			t.Errorf("delta %d: Map at (3, 5) = %v", tt.delta, r.Map.Image.At(3, 5))
+		}
+	}
+}
+
+// 左上が(0, 0)でない画像も、それぞれの左上をそろえて比べる。
+func TestDiffOffset(t *testing.T) {
+	m := randomRGBA(image.Rect(0, 0, 20, 12))
+	shifted := func(x, y int) image.Image {
+		s := image.NewRGBA(m.Rect.Add(image.Pt(x, y)))
+		draw.Draw(s, s.Rect, m, image.Point{}, draw.Src)
+		return s
+	}
+	for _, tt := range []struct {
+		name string
+		a, b image.Image
+	}{
+		{"a", shifted(5, 7), m},
+		{"b", m, shifted(-3, 2)},
+		{"both", shifted(5, 7), shifted(-3, 2)},
+		{"subimage", m.SubImage(image.Rect(4, 4, 12, 10)), shifted(-4, -4).(*image.RGBA).SubImage(image.Rect(0, 0, 8, 6))},
+	} {
+		r, err := Diff(newImg(tt.a, "", ""), newImg(tt.b, "", ""), 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if want := tt.a.Bounds().Size(); r.Size != want {
+			t.Errorf("%s: Size = %v, want %v", tt.name, r.Size, want)
+		}
+		if r.Differing != 0 || !math.IsInf(r.PSNR, 1) {
+			t.Errorf("%s: Differing, PSNR = %d, %v, want 0, +Inf", tt.name, r.Differing, r.PSNR)
+		}
+	}
+}
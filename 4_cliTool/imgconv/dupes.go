@@ -0,0 +1,119 @@
+package imgconv
+
+import "context"
+
+// DupeFinder はディレクトリ以下から見た目の似た画像を探す。
+type DupeFinder struct {
+	Kind      HashKind      // 使う知覚ハッシュ
+	Threshold int           // ハミング距離がこの値以下(この値を含む)なら同じ画像とみなす。0なら同じハッシュだけ
+	Decode    DecodeOptions // 読み込むときの設定
+	Jobs      int           // 同時にハッシュを計算するファイルの数。0なら1
+}
+
+// HashedFile は画像ファイルとそのハッシュ。
+type HashedFile struct {
+	Path string `json:"path"`
+	Hash Hash   `json:"hash"`
+}
+
+// DupeReport は似た画像を探した結果。
+type DupeReport struct {
+	Groups [][]HashedFile // 似た画像のまとまり。2枚以上のものだけを入れる
+	Failed []*Failure     // 読み込めなかったファイル
+}
+
+// FindDir は root 以下の画像を全てハッシュにして、似た画像をまとめる。
+func (f *DupeFinder) FindDir(root string) (*DupeReport, error) {
+	return f.FindDirContext(context.Background(), root)
+}
+
+// FindDirContext はFindDirと同じだが、ctx が終わると新しいファイルを読み込まずに
+// それまでにハッシュにした画像だけでまとめた結果とctx.Err()を返す。
+//
+// どれかの画像との距離がThreshold以下(Thresholdちょうども含む)なら同じまとまりに入れるので、
+// 同じまとまりの中でも距離がThresholdより大きい組があり得る。
+// まとまりの中とまとまりの順は、ディレクトリをたどった順になる。
+func (f *DupeFinder) FindDirContext(ctx context.Context, root string) (*DupeReport, error) {
+	paths, failures, err := imageFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]HashedFile, len(paths))
+	errs := make([]error, len(paths))
+	done := make([]bool, len(paths))
+	forEach(ctx, len(paths), f.Jobs, func(i int) {
+		img, err := LoadImageWith(paths[i], &f.Decode)
+		if err == nil {
+			files[i] = HashedFile{Path: paths[i], Hash: img.Hash(f.Kind)}
+		}
+		errs[i], done[i] = err, true
+	})
+
+	report := &DupeReport{Failed: failures}
+	var hashed []HashedFile
+	for i := range paths {
+		switch {
+		case !done[i]:
+		case errs[i] != nil:
+			report.fail(paths[i], errs[i])
+		default:
+			hashed = append(hashed, files[i])
+		}
+	}
+	report.Groups = group(hashed, f.Threshold)
+	return report, ctx.Err()
+}
+
+// group は距離が threshold 以下(threshold を含む)の画像をつないだまとまりのうち、2枚以上のものを返す。
+func group(files []HashedFile, threshold int) [][]HashedFile {
+	// Union-Findで、各まとまりの代表はその中で最初の画像にする
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range files {
+		for j := i + 1; j < len(files); j++ {
+			if Distance(files[i].Hash, files[j].Hash) > threshold {
+				continue
+			}
+			a, b := find(i), find(j)
+			if a > b {
+				a, b = b, a
+			}
+			parent[b] = a
+		}
+	}
+
+	index := make(map[int]int)
+	var groups [][]HashedFile
+	for i, file := range files {
+		root := find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], file)
+	}
+
+	dupes := groups[:0]
+	for _, g := range groups {
+		if len(g) > 1 {
+			dupes = append(dupes, g)
+		}
+	}
+	return dupes
+}
+
+func (r *DupeReport) fail(path string, err error) {
+	r.Failed = append(r.Failed, &Failure{Path: path, Err: err})
+}
@@ -0,0 +1,38 @@
+package imgconv
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 距離がちょうどthresholdの画像も同じまとまりに入る。
+func TestGroupThreshold(t *testing.T) {
+	files := []HashedFile{
+		{Path: "a", Hash: 0},
+		{Path: "b", Hash: 0b111},     // aとの距離は3
+		{Path: "c", Hash: 0b1111000}, // bとの距離は7、aとの距離は4
+	}
+	paths := func(groups [][]HashedFile) [][]string {
+		var out [][]string
+		for _, g := range groups {
+			var ps []string
+			for _, f := range g {
+				ps = append(ps, f.Path)
+			}
+			out = append(out, ps)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		threshold int
+		want      [][]string
+	}{
+		{2, nil},
+		{3, [][]string{{"a", "b"}}},
+		{4, [][]string{{"a", "b", "c"}}},
+	} {
+		if got := paths(group(files, tt.threshold)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("threshold %d: %v, want %v", tt.threshold, got, tt.want)
+		}
+	}
+}
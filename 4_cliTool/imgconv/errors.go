@@ -0,0 +1,82 @@
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+)
+
+var (
+	// ErrUnknownFormat は画像形式の名前や拡張子がわからないときのエラー。
+	ErrUnknownFormat = errors.New("unknown image format")
+	// ErrUnsupported は書き出せない画像形式を指定したときのエラー。
+	ErrUnsupported = errors.New("encoding not supported")
+)
+
+// DecodeError は画像の読み込みに失敗したときのエラー。
+// 中身が画像でない場合、Errはimage.ErrFormatになる。
+type DecodeError struct {
+	Path   string // 読み込んだファイル。Decodeの場合は空
+	Format string // 拡張子から推測した画像形式。わからなければ空
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return "decode " + describe(e.Path, e.Format) + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError は画像の書き出しに失敗したときのエラー。
+type EncodeError struct {
+	Path   string // 書き出したファイル。Encodeの場合は空
+	Format string // 書き出そうとした画像形式
+	Err    error
+}
+
+func (e *EncodeError) Error() string {
+	return "encode " + describe(e.Path, e.Format) + ": " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// SizeMismatchError はDiffで大きさの違う画像を比べようとしたときのエラー。
+type SizeMismatchError struct {
+	A, B image.Point // それぞれの画像の大きさ
+}
+
+func (e *SizeMismatchError) Error() string {
+	return fmt.Sprintf("image sizes differ: %dx%d != %dx%d", e.A.X, e.A.Y, e.B.X, e.B.Y)
+}
+
+// describe はエラーメッセージ用にパスと画像形式を並べる。
+func describe(path, format string) string {
+	switch {
+	case path == "":
+		return format
+	case format == "":
+		return path
+	}
+	return path + " (" + format + ")"
+}
+
+// hasPath は err がパスを含むエラーかを返す。
+func hasPath(err error) bool {
+	var (
+		pe *fs.PathError
+		de *DecodeError
+		ee *EncodeError
+	)
+	switch {
+	case errors.As(err, &de):
+		return de.Path != ""
+	case errors.As(err, &ee):
+		return ee.Path != ""
+	}
+	return errors.As(err, &pe)
+}
@@ -0,0 +1,310 @@
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+)
+
+// Metadata はJPEGのEXIFから読み取った情報。
+type Metadata struct {
+	Make, Model   string    // カメラのメーカーと機種
+	DateTime      time.Time // 撮影日時。わからなければゼロ値
+	Width, Height int       // EXIFに記録された幅と高さ。なければ0
+	Orientation   int       // 画像の向き(1から8)。なければ0
+
+	exif           []byte // "Exif\x00\x00"に続くTIFF形式のデータ
+	orientationOff int    // exif の中のOrientationの値の位置。なければ-1
+}
+
+// EXIFのタグ
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagPixelXDimension  = 0xa002
+	tagPixelYDimension  = 0xa003
+)
+
+// EXIFの値の型
+const (
+	typeASCII = 2
+	typeShort = 3
+	typeLong  = 4
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// readMetadata はJPEGの先頭のセグメントからEXIFを探す。
+// 読み込んだ分を含めて r と同じ内容を読めるReaderを返す。
+// JPEGでない場合やEXIFがない場合、壊れている場合はnilを返す。
+func readMetadata(r io.Reader) (*Metadata, io.Reader) {
+	var buf bytes.Buffer
+	meta := findExif(io.TeeReader(r, &buf))
+	return meta, io.MultiReader(&buf, r)
+}
+
+// findExif はSOSまでのセグメントを順に読み、APP1のEXIFを探す。
+func findExif(r io.Reader) *Metadata {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xff {
+			return nil
+		}
+		// SOS以降は画像のデータ
+		if marker[1] == 0xda {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(data, exifHeader) {
+			meta, err := parseExif(data[len(exifHeader):])
+			if err != nil {
+				return nil
+			}
+			return meta
+		}
+	}
+}
+
+var errBadExif = errors.New("imgconv: malformed exif")
+
+// parseExif はTIFF形式のEXIFデータを解析する。
+func parseExif(data []byte) (*Metadata, error) {
+	if len(data) < 8 {
+		return nil, errBadExif
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errBadExif
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, errBadExif
+	}
+
+	meta := &Metadata{exif: data, orientationOff: -1}
+	p := &exifParser{data: data, order: order}
+	var dateTime, original string
+	exifIFD := 0
+	err := p.ifd(int(order.Uint32(data[4:])), func(tag, typ, count, off int) {
+		switch tag {
+		case tagMake:
+			meta.Make = p.ascii(typ, count, off)
+		case tagModel:
+			meta.Model = p.ascii(typ, count, off)
+		case tagDateTime:
+			dateTime = p.ascii(typ, count, off)
+		case tagOrientation:
+			if typ == typeShort {
+				meta.Orientation = int(order.Uint16(data[off:]))
+				meta.orientationOff = off
+			}
+		case tagExifIFD:
+			exifIFD = p.uint(typ, off)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if exifIFD > 0 {
+		err := p.ifd(exifIFD, func(tag, typ, count, off int) {
+			switch tag {
+			case tagDateTimeOriginal:
+				original = p.ascii(typ, count, off)
+			case tagPixelXDimension:
+				meta.Width = p.uint(typ, off)
+			case tagPixelYDimension:
+				meta.Height = p.uint(typ, off)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 撮影日時があれば更新日時より優先する
+	if original != "" {
+		dateTime = original
+	}
+	if t, err := time.ParseInLocation("2006:01:02 15:04:05", dateTime, time.Local); err == nil {
+		meta.DateTime = t
+	}
+	return meta, nil
+}
+
+type exifParser struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// ifd は off の位置のIFDのエントリを順に fn に渡す。
+// fn の off は値の位置で、4バイト以下の値はエントリの中にある。
+// IFDや文字列の値がデータの外にはみ出していればerrBadExifを返す。
+func (p *exifParser) ifd(off int, fn func(tag, typ, count, off int)) error {
+	if off < 0 || off+2 > len(p.data) {
+		return errBadExif
+	}
+	n := int(p.order.Uint16(p.data[off:]))
+	off += 2
+	if off+n*12 > len(p.data) {
+		return errBadExif
+	}
+	for i := 0; i < n; i++ {
+		e := p.data[off+i*12:]
+		tag := int(p.order.Uint16(e))
+		typ := int(p.order.Uint16(e[2:]))
+		count := int(p.order.Uint32(e[4:]))
+		valueOff := off + i*12 + 8
+		if typ == typeASCII && count > 4 {
+			valueOff = int(p.order.Uint32(e[8:]))
+			// 値がデータの外にはみ出していれば壊れている
+			if valueOff < 0 || valueOff > len(p.data) || count > len(p.data)-valueOff {
+				return errBadExif
+			}
+		}
+		fn(tag, typ, count, valueOff)
+	}
+	return nil
+}
+
+func (p *exifParser) ascii(typ, count, off int) string {
+	if typ != typeASCII || count < 0 || count > len(p.data)-off {
+		return ""
+	}
+	return strings.TrimRight(string(p.data[off:off+count]), "\x00 ")
+}
+
+func (p *exifParser) uint(typ, off int) int {
+	switch typ {
+	case typeShort:
+		return int(p.order.Uint16(p.data[off:]))
+	case typeLong:
+		return int(p.order.Uint32(p.data[off:]))
+	}
+	return 0
+}
+
+// orient はEXIFの向きに合わせて画像を回転、反転する。
+func (img Img) orient() Img {
+	if img.Meta == nil {
+		return img
+	}
+	switch img.Meta.Orientation {
+	case 2:
+		img = img.FlipH()
+	case 3:
+		img = img.Rotate180()
+	case 4:
+		img = img.FlipV()
+	case 5:
+		img = img.Rotate90().FlipH()
+	case 6:
+		img = img.Rotate90()
+	case 7:
+		img = img.Rotate270().FlipH()
+	case 8:
+		img = img.Rotate270()
+	default:
+		return img
+	}
+	img.Meta = img.Meta.withOrientation(1)
+	return img
+}
+
+// withOrientation は向きを書き換えたコピーを返す。
+func (m *Metadata) withOrientation(o int) *Metadata {
+	c := *m
+	c.Orientation = o
+	if c.orientationOff >= 0 {
+		c.exif = append([]byte(nil), m.exif...)
+		order := binary.ByteOrder(binary.LittleEndian)
+		if string(c.exif[:2]) == "MM" {
+			order = binary.BigEndian
+		}
+		order.PutUint16(c.exif[c.orientationOff:], uint16(o))
+	}
+	return &c
+}
+
+// metadataWriter は書き出す画像にEXIFを埋め込む。
+// JPEGはSOIの直後にAPP1を、PNGはIHDRの直後にeXIfチャンクを入れる。
+// それ以外の形式では何もしない。
+func metadataWriter(w io.Writer, format string, meta *Metadata) io.Writer {
+	if meta == nil || len(meta.exif) == 0 {
+		return w
+	}
+	switch format {
+	case "jpeg":
+		size := 2 + len(exifHeader) + len(meta.exif)
+		if size > 0xffff {
+			return w
+		}
+		seg := []byte{0xff, 0xe1, byte(size >> 8), byte(size)}
+		seg = append(seg, exifHeader...)
+		seg = append(seg, meta.exif...)
+		return &insertWriter{w: w, at: 2, data: seg}
+	case "png":
+		// シグネチャ(8) + IHDR(4 + 4 + 13 + 4)
+		const afterIHDR = 33
+		chunk := make([]byte, 8, 12+len(meta.exif))
+		binary.BigEndian.PutUint32(chunk, uint32(len(meta.exif)))
+		copy(chunk[4:], "eXIf")
+		chunk = append(chunk, meta.exif...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+		return &insertWriter{w: w, at: afterIHDR, data: chunk}
+	}
+	return w
+}
+
+// insertWriter は先頭から at バイト書いたところに data を入れる。
+type insertWriter struct {
+	w       io.Writer
+	at      int
+	data    []byte
+	written int
+}
+
+func (iw *insertWriter) Write(b []byte) (int, error) {
+	if iw.data == nil || iw.written+len(b) < iw.at {
+		n, err := iw.w.Write(b)
+		iw.written += n
+		return n, err
+	}
+
+	head := iw.at - iw.written
+	n, err := iw.w.Write(b[:head])
+	iw.written += n
+	if err != nil {
+		return n, err
+	}
+	if _, err := iw.w.Write(iw.data); err != nil {
+		return n, err
+	}
+	iw.data = nil
+	m, err := iw.w.Write(b[head:])
+	return n + m, err
+}
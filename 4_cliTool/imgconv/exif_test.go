@@ -0,0 +1,340 @@
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// exifOrder はEXIFデータを組み立てるためのバイトオーダー。
+type exifOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type exifEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte // 4バイトより長ければIFDの後ろに置く
+}
+
+// buildExif は ifd0 と exif のIFDを持つTIFF形式のEXIFデータを作る。
+// exif が空でなければ、ifd0 の最後にExif IFDへのポインタを足す。
+func buildExif(order exifOrder, ifd0, exif []exifEntry) []byte {
+	if len(exif) > 0 {
+		ifd0 = append(ifd0, exifEntry{tag: tagExifIFD, typ: typeLong, count: 1, value: make([]byte, 4)})
+	}
+	ifdSize := func(es []exifEntry) int { return 2 + 12*len(es) + 4 }
+	exifOff := 8 + ifdSize(ifd0)
+	dataOff := exifOff + ifdSize(exif)
+	if len(exif) > 0 {
+		order.PutUint32(ifd0[len(ifd0)-1].value, uint32(exifOff))
+	}
+
+	var ifds, data []byte
+	put := func(es []exifEntry) {
+		ifds = order.AppendUint16(ifds, uint16(len(es)))
+		for _, e := range es {
+			ifds = order.AppendUint16(ifds, e.tag)
+			ifds = order.AppendUint16(ifds, e.typ)
+			ifds = order.AppendUint32(ifds, e.count)
+			if len(e.value) > 4 {
+				ifds = order.AppendUint32(ifds, uint32(dataOff+len(data)))
+				data = append(data, e.value...)
+				continue
+			}
+			var v [4]byte
+			copy(v[:], e.value)
+			ifds = append(ifds, v[:]...)
+		}
+		ifds = order.AppendUint32(ifds, 0)
+	}
+	put(ifd0)
+	if len(exif) > 0 {
+		put(exif)
+	}
+
+	b := []byte("II")
+	if order == binary.BigEndian {
+		b = []byte("MM")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+	b = append(b, ifds...)
+	return append(b, data...)
+}
+
+func asciiEntry(tag uint16, s string) exifEntry {
+	return exifEntry{tag: tag, typ: typeASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func shortEntry(order exifOrder, tag, v uint16) exifEntry {
+	return exifEntry{tag: tag, typ: typeShort, count: 1, value: order.AppendUint16(nil, v)}
+}
+
+func longEntry(order exifOrder, tag uint16, v uint32) exifEntry {
+	return exifEntry{tag: tag, typ: typeLong, count: 1, value: order.AppendUint32(nil, v)}
+}
+
+// sampleExif はひととおりのタグを持つEXIFデータを作る。
+// Makeは4バイトより長いのでIFDの外に、Modelは4バイトなのでエントリの中に入る。
+func sampleExif(order exifOrder, orientation uint16) []byte {
+	return buildExif(order,
+		[]exifEntry{
+			asciiEntry(tagMake, "Canon"),
+			asciiEntry(tagModel, "EOS"),
+			shortEntry(order, tagOrientation, orientation),
+			asciiEntry(tagDateTime, "2020:01:02 03:04:05"),
+		},
+		[]exifEntry{
+			asciiEntry(tagDateTimeOriginal, "2019:12:31 23:59:58"),
+			shortEntry(order, tagPixelXDimension, 640),
+			longEntry(order, tagPixelYDimension, 480),
+		})
+}
+
+func TestParseExif(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		order exifOrder
+	}{
+		{"II", binary.LittleEndian},
+		{"MM", binary.BigEndian},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := parseExif(sampleExif(tt.order, 6))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Make != "Canon" || meta.Model != "EOS" {
+				t.Errorf("Make, Model = %q, %q, want %q, %q", meta.Make, meta.Model, "Canon", "EOS")
+			}
+			if meta.Orientation != 6 {
+				t.Errorf("Orientation = %d, want 6", meta.Orientation)
+			}
+			if meta.Width != 640 || meta.Height != 480 {
+				t.Errorf("Width, Height = %d, %d, want 640, 480", meta.Width, meta.Height)
+			}
+			// 撮影日時が更新日時より優先される
+			want := time.Date(2019, 12, 31, 23, 59, 58, 0, time.Local)
+			if !meta.DateTime.Equal(want) {
+				t.Errorf("DateTime = %v, want %v", meta.DateTime, want)
+			}
+		})
+	}
+}
+
+// 壊れたデータはパニックせずにエラーになる。
+func TestParseExifMalformed(t *testing.T) {
+	le := binary.LittleEndian
+	valid := sampleExif(le, 1)
+
+	// Makeの値の位置を書き換える
+	makeValue := 8 + 2 + 8
+	withMakeOffset := func(off uint32) []byte {
+		b := append([]byte(nil), valid...)
+		le.PutUint32(b[makeValue:], off)
+		return b
+	}
+	withMakeCount := func(count uint32) []byte {
+		b := append([]byte(nil), valid...)
+		le.PutUint32(b[makeValue-4:], count)
+		return b
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", []byte("II*\x00")},
+		{"bad byte order", append([]byte("XX"), valid[2:]...)},
+		{"bad magic", append([]byte("II\x2b\x00"), valid[4:]...)},
+		{"IFD offset past end", append(append([]byte(nil), valid[:4]...), 0xff, 0xff, 0, 0)},
+		{"truncated IFD", valid[:8+2+12*2]},
+		{"ASCII offset past end", withMakeOffset(uint32(len(valid)))},
+		{"ASCII offset overflow", withMakeOffset(0xffffffff)},
+		{"ASCII count past end", withMakeCount(uint32(len(valid)))},
+		{"ASCII count overflow", withMakeCount(0xffffffff)},
+		{"Exif IFD past end", buildExif(le, []exifEntry{longEntry(le, tagExifIFD, 0xffff)}, nil)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseExif(tt.data); !errors.Is(err, errBadExif) {
+				t.Errorf("err = %v, want %v", err, errBadExif)
+			}
+		})
+	}
+
+	// どこで切れていてもパニックしない
+	for _, order := range []exifOrder{binary.LittleEndian, binary.BigEndian} {
+		data := sampleExif(order, 1)
+		for i := range data {
+			parseExif(data[:i])
+		}
+	}
+}
+
+// 向きごとに、表示したときの左上から順に並ぶ画素が元の画像のどこにあるか。
+// 元の画像は幅3、高さ2。
+func TestOrient(t *testing.T) {
+	const w, h = 3, 2
+	for _, tt := range []struct {
+		orientation int
+		size        image.Point
+		at          func(x, y int) (int, int)
+	}{
+		{1, image.Pt(w, h), func(x, y int) (int, int) { return x, y }},
+		{2, image.Pt(w, h), func(x, y int) (int, int) { return w - 1 - x, y }},
+		{3, image.Pt(w, h), func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+		{4, image.Pt(w, h), func(x, y int) (int, int) { return x, h - 1 - y }},
+		{5, image.Pt(h, w), func(x, y int) (int, int) { return y, x }},
+		{6, image.Pt(h, w), func(x, y int) (int, int) { return y, h - 1 - x }},
+		{7, image.Pt(h, w), func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }},
+		{8, image.Pt(h, w), func(x, y int) (int, int) { return w - 1 - y, x }},
+	} {
+		src := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				src.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 0xff})
+			}
+		}
+		meta, err := parseExif(sampleExif(binary.BigEndian, uint16(tt.orientation)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := newImg(src, "", "")
+		img.Meta = meta
+
+		got := img.orient()
+		if size := got.Image.Bounds().Size(); size != tt.size {
+			t.Errorf("orientation %d: size = %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+		for y := 0; y < tt.size.Y; y++ {
+			for x := 0; x < tt.size.X; x++ {
+				sx, sy := tt.at(x, y)
+				if c := got.Image.At(x, y); c != src.At(sx, sy) {
+					t.Errorf("orientation %d: (%d, %d) = %v, want (%d, %d)", tt.orientation, x, y, c, sx, sy)
+				}
+			}
+		}
+		if got.Meta.Orientation != 1 {
+			t.Errorf("orientation %d: Meta.Orientation = %d, want 1", tt.orientation, got.Meta.Orientation)
+		}
+	}
+}
+
+// 向きを直して書き出すと、EXIFの向きは1になり、ほかの情報は残る。
+func TestKeepMetadata(t *testing.T) {
+	jpegFormat, err := LookupFormat("jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pngFormat, err := LookupFormat("png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		order exifOrder
+	}{
+		{"II", binary.LittleEndian},
+		{"MM", binary.BigEndian},
+	} {
+		meta, err := parseExif(sampleExif(tt.order, 6))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := newImg(image.NewRGBA(image.Rect(0, 0, 16, 8)), "", "")
+		src.Meta = meta
+
+		// 向きが6のJPEGを作って読み込むと、回転して向きが1になる
+		var buf bytes.Buffer
+		if err := src.Encode(&buf, jpegFormat, &EncodeOptions{KeepMetadata: true}); err != nil {
+			t.Fatal(err)
+		}
+		img, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := img.Image.Bounds().Size(); size != image.Pt(8, 16) {
+			t.Fatalf("%s: size = %v, want (8,16)", tt.name, size)
+		}
+		checkMeta(t, tt.name, img.Meta)
+
+		t.Run(tt.name+"/jpeg", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := img.Encode(&buf, jpegFormat, &EncodeOptions{KeepMetadata: true}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeWith(&buf, &DecodeOptions{IgnoreOrientation: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMeta(t, "jpeg", got.Meta)
+		})
+
+		t.Run(tt.name+"/png", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := img.Encode(&buf, pngFormat, &EncodeOptions{KeepMetadata: true}); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			exif := pngChunk(t, data, "eXIf")
+			got, err := parseExif(exif)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMeta(t, "png", got)
+			// eXIfチャンクがあってもPNGとして読める
+			if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func checkMeta(t *testing.T, name string, meta *Metadata) {
+	t.Helper()
+	if meta == nil {
+		t.Fatalf("%s: no metadata", name)
+	}
+	if meta.Orientation != 1 {
+		t.Errorf("%s: Orientation = %d, want 1", name, meta.Orientation)
+	}
+	if meta.Make != "Canon" || meta.Model != "EOS" || meta.Width != 640 || meta.Height != 480 {
+		t.Errorf("%s: metadata = %+v", name, meta)
+	}
+}
+
+// pngChunk は typ のチャンクの中身を返す。
+// IHDRの直後にあり、CRCが正しいことも確かめる。
+func pngChunk(t *testing.T, data []byte, typ string) []byte {
+	t.Helper()
+	b := data[8:]
+	for i := 0; len(b) >= 12; i++ {
+		n := int(binary.BigEndian.Uint32(b))
+		if 12+n > len(b) {
+			break
+		}
+		if string(b[4:8]) == typ {
+			if i != 1 {
+				t.Errorf("%s is chunk %d, want 1", typ, i)
+			}
+			if crc := binary.BigEndian.Uint32(b[8+n:]); crc != crc32.ChecksumIEEE(b[4:8+n]) {
+				t.Errorf("%s: bad CRC", typ)
+			}
+			return b[8 : 8+n]
+		}
+		b = b[12+n:]
+	}
+	t.Fatalf("no %s chunk", typ)
+	return nil
+}
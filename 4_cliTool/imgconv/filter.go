@@ -0,0 +1,117 @@
+package imgconv
+
+import (
+	"image"
+	"math"
+)
+
+// GaussianBlur は標準偏差 sigma のガウスぼかしをかけた画像を返す。
+// 縦と横に分けて畳み込むので、sigmaが大きくても速い。
+// sigma が0以下なら元の画像を返す。
+func (img Img) GaussianBlur(sigma float64) Img {
+	if sigma <= 0 {
+		return img
+	}
+	src := toRGBA(img.Image)
+	kernel := gaussianKernel(sigma)
+	tmp := image.NewRGBA(src.Rect)
+	dst := image.NewRGBA(src.Rect)
+	convolve1D(tmp, src, kernel, 1, 0)
+	convolve1D(dst, tmp, kernel, 0, 1)
+	return img.with(dst)
+}
+
+// Sharpen は輪郭を強調した画像を返す。
+//
+//	 0 -1  0
+//	-1  5 -1
+//	 0 -1  0
+//
+// のカーネルで畳み込む。
+func (img Img) Sharpen() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(src.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := src.Pix[y*src.Stride+x*4:]
+			up := src.Pix[clamp(y-1, h)*src.Stride+x*4:]
+			down := src.Pix[clamp(y+1, h)*src.Stride+x*4:]
+			left := src.Pix[y*src.Stride+clamp(x-1, w)*4:]
+			right := src.Pix[y*src.Stride+clamp(x+1, w)*4:]
+			d := dst.Pix[y*dst.Stride+x*4:]
+
+			// アルファはそのまま。乗算済みなので色はアルファを超えないようにする
+			a := c[3]
+			for i := 0; i < 3; i++ {
+				v := 5*int(c[i]) - int(up[i]) - int(down[i]) - int(left[i]) - int(right[i])
+				d[i] = clampByte(v, int(a))
+			}
+			d[3] = a
+		}
+	}
+	return img.with(dst)
+}
+
+// gaussianKernel は合計が1になる1次元のガウスカーネルを返す。
+// 半径は3σまで。
+func gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, radius*2+1)
+	sum := 0.0
+	for i := range kernel {
+		x := float64(i - radius)
+		kernel[i] = math.Exp(-x * x / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// convolve1D は (dx, dy) の向きに kernel を畳み込む。
+// 画像の端は一番端の画素を延長する。
+func convolve1D(dst, src *image.RGBA, kernel []float64, dx, dy int) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	radius := len(kernel) / 2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]float64
+			for k, weight := range kernel {
+				sx := clamp(x+(k-radius)*dx, w)
+				sy := clamp(y+(k-radius)*dy, h)
+				p := src.Pix[sy*src.Stride+sx*4:]
+				for i := range sum {
+					sum[i] += weight * float64(p[i])
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			for i := range sum {
+				d[i] = uint8(math.Min(255, sum[i]+0.5))
+			}
+		}
+	}
+}
+
+// clamp は v を [0, n) に収める。
+func clamp(v, n int) int {
+	switch {
+	case v < 0:
+		return 0
+	case v >= n:
+		return n - 1
+	}
+	return v
+}
+
+// clampByte は v を [0, max] に収める。
+func clampByte(v, max int) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > max:
+		return uint8(max)
+	}
+	return uint8(v)
+}
@@ -0,0 +1,129 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // 読み込みのみ
+)
+
+// Format は画像形式。
+type Format struct {
+	Name string   // image.Decodeが返す形式名
+	Exts []string // 拡張子。先頭を書き出すときに使う
+	// 書き出す関数。nilなら読み込みのみ
+	Encode func(w io.Writer, m image.Image, opts *EncodeOptions) error
+}
+
+// EncodeOptions は書き出すときの設定。
+type EncodeOptions struct {
+	JPEGQuality    int                  // 1から100。0ならjpeg.DefaultQuality
+	PNGCompression png.CompressionLevel // PNGの圧縮レベル
+	// 読み込んだ画像のEXIFを書き出す画像に入れる。JPEGとPNGのみ
+	KeepMetadata bool
+}
+
+// Ext は書き出すときの拡張子を返す。
+func (f *Format) Ext() string {
+	return f.Exts[0]
+}
+
+// formats は扱える画像形式。読み込みはimage.Decodeに登録されたものを使う。
+var formats = []*Format{
+	{
+		Name: "jpeg",
+		Exts: []string{".jpg", ".jpeg"},
+		Encode: func(w io.Writer, m image.Image, opts *EncodeOptions) error {
+			q := opts.JPEGQuality
+			if q == 0 {
+				q = jpeg.DefaultQuality
+			}
+			return jpeg.Encode(w, m, &jpeg.Options{Quality: q})
+		},
+	},
+	{
+		Name: "png",
+		Exts: []string{".png"},
+		Encode: func(w io.Writer, m image.Image, opts *EncodeOptions) error {
+			enc := png.Encoder{CompressionLevel: opts.PNGCompression}
+			return enc.Encode(w, m)
+		},
+	},
+	{
+		Name: "gif",
+		Exts: []string{".gif"},
+		Encode: func(w io.Writer, m image.Image, _ *EncodeOptions) error {
+			return gif.Encode(w, m, nil)
+		},
+	},
+	{
+		Name: "bmp",
+		Exts: []string{".bmp"},
+		Encode: func(w io.Writer, m image.Image, _ *EncodeOptions) error {
+			return bmp.Encode(w, m)
+		},
+	},
+	{
+		Name: "tiff",
+		Exts: []string{".tiff", ".tif"},
+		Encode: func(w io.Writer, m image.Image, _ *EncodeOptions) error {
+			return tiff.Encode(w, m, &tiff.Options{Compression: tiff.Deflate})
+		},
+	},
+	{
+		Name: "webp",
+		Exts: []string{".webp"},
+	},
+}
+
+// LookupFormat は形式名または拡張子("jpg", ".png" など)から画像形式を探す。
+func LookupFormat(name string) (*Format, error) {
+	name = strings.ToLower(name)
+	ext := name
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	for _, f := range formats {
+		if f.Name == name {
+			return f, nil
+		}
+		for _, e := range f.Exts {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, name)
+}
+
+// FormatOf は拡張子からファイルの画像形式を探す。
+func FormatOf(path string) (*Format, error) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return nil, fmt.Errorf("%w: %s has no file extension", ErrUnknownFormat, path)
+	}
+	return LookupFormat(ext)
+}
+
+// ParseCompression はPNGの圧縮レベルの名前を解析する。
+func ParseCompression(name string) (png.CompressionLevel, error) {
+	switch name {
+	case "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "speed":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+	return 0, fmt.Errorf("unknown compression level %q", name)
+}
@@ -0,0 +1,96 @@
+package imgconv
+
+import (
+	"image"
+	"image/color"
+)
+
+/*
+image.Rectの戻り値 image.Rectangle
+
+	type Point struct {
+		x, y int
+	}
+
+	type Rectangle struct {
+		X, Y Point
+	}
+*/
+
+// Gray はグレースケールに変換した画像を返す。
+// 変換後の画像は元の画像と同じBounds()を持つ。
+//
+// JPEGを読み込んだときの*image.YCbCrはYの値をそのまま使う。
+// *image.RGBA, *image.NRGBA, *image.Grayも1画素ごとに
+// At, Setを呼ばずにPixを直接読み書きする。
+func (img Img) Gray() Img {
+	b := img.Image.Bounds()
+	canvas := image.NewGray(b)
+
+	switch src := img.Image.(type) {
+	case *image.YCbCr:
+		grayYCbCr(canvas, src)
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(canvas.Pix[canvas.PixOffset(b.Min.X, y):], src.Pix[src.PixOffset(b.Min.X, y):][:b.Dx()])
+		}
+	case *image.RGBA:
+		grayRGBA(canvas, src)
+	case *image.NRGBA:
+		grayNRGBA(canvas, src)
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := canvas.Pix[canvas.PixOffset(b.Min.X, y):]
+			for x := b.Min.X; x < b.Max.X; x++ {
+				row[x-b.Min.X] = color.GrayModel.Convert(src.At(x, y)).(color.Gray).Y
+			}
+		}
+	}
+
+	return img.with(canvas)
+}
+
+// grayYCbCr は輝度(Y)をそのままコピーする。
+func grayYCbCr(dst *image.Gray, src *image.YCbCr) {
+	b := src.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		yi := src.YOffset(b.Min.X, y)
+		copy(dst.Pix[dst.PixOffset(b.Min.X, y):], src.Y[yi:yi+b.Dx()])
+	}
+}
+
+// grayRGBA はcolor.GrayModelと同じ式で変換する。
+func grayRGBA(dst *image.Gray, src *image.RGBA) {
+	b := src.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		s := src.Pix[src.PixOffset(b.Min.X, y):]
+		d := dst.Pix[dst.PixOffset(b.Min.X, y):]
+		for i := range d[:b.Dx()] {
+			p := s[i*4 : i*4+3 : i*4+3]
+			d[i] = luma(uint32(p[0])*0x101, uint32(p[1])*0x101, uint32(p[2])*0x101)
+		}
+	}
+}
+
+// grayNRGBA はcolor.NRGBA.RGBAと同じくアルファを掛けてから変換する。
+func grayNRGBA(dst *image.Gray, src *image.NRGBA) {
+	b := src.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		s := src.Pix[src.PixOffset(b.Min.X, y):]
+		d := dst.Pix[dst.PixOffset(b.Min.X, y):]
+		for i := range d[:b.Dx()] {
+			p := s[i*4 : i*4+4 : i*4+4]
+			a := uint32(p[3])
+			d[i] = luma(
+				uint32(p[0])*0x101*a/0xff,
+				uint32(p[1])*0x101*a/0xff,
+				uint32(p[2])*0x101*a/0xff,
+			)
+		}
+	}
+}
+
+// luma は16bitのRGBから8bitの輝度を求める。color.GrayModelと同じ式。
+func luma(r, g, b uint32) uint8 {
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
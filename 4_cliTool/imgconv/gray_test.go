@@ -0,0 +1,117 @@
+package imgconv
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// 左上が(0, 0)でない画像でも、各変換がcolor.GrayModelと同じ値になる。
+func TestGray(t *testing.T) {
+	r := image.Rect(3, 5, 40, 30)
+	for _, tt := range []struct {
+		name string
+		src  image.Image
+	}{
+		{"YCbCr", randomYCbCr(r)},
+		{"Gray", randomGray(r)},
+		{"RGBA", randomRGBA(r)},
+		{"NRGBA", randomNRGBA(r)},
+		{"generic", randomRGBA64(r)},
+		{"opaque", opaque{randomYCbCr(r)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newImg(tt.src, "", "").Gray().Image.(*image.Gray)
+			if got.Rect != r {
+				t.Fatalf("Bounds() = %v, want %v", got.Rect, r)
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					want := color.GrayModel.Convert(tt.src.At(x, y)).(color.Gray).Y
+					if got.GrayAt(x, y).Y != want {
+						t.Fatalf("(%d, %d) = %d, want %d", x, y, got.GrayAt(x, y).Y, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// 同じYCbCrの画像で、型を隠して速い経路を使わない場合とも比べる。
+func BenchmarkGray(b *testing.B) {
+	r := image.Rect(0, 0, 1920, 1080)
+	ycbcr := randomYCbCr(r)
+	for _, bm := range []struct {
+		name string
+		src  image.Image
+	}{
+		{"YCbCr", ycbcr},
+		{"YCbCr/fallback", opaque{ycbcr}},
+		{"RGBA", randomRGBA(r)},
+		{"NRGBA", randomNRGBA(r)},
+		{"generic", randomRGBA64(r)},
+	} {
+		img := newImg(bm.src, "", "")
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				img.Gray()
+			}
+		})
+	}
+}
+
+// opaque は具体的な型を隠して、image.Imageのメソッドだけを持つ画像。
+type opaque struct{ image.Image }
+
+func randomYCbCr(r image.Rectangle) *image.YCbCr {
+	rnd := rand.New(rand.NewSource(1))
+	m := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	// YはRGBを経由しないので、RGBにしたときに0-255に収まる範囲にする
+	for i := range m.Y {
+		m.Y[i] = uint8(40 + rnd.Intn(176))
+	}
+	for i := range m.Cb {
+		m.Cb[i] = uint8(108 + rnd.Intn(40))
+		m.Cr[i] = uint8(108 + rnd.Intn(40))
+	}
+	return m
+}
+
+func randomGray(r image.Rectangle) *image.Gray {
+	m := image.NewGray(r)
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	return m
+}
+
+func randomRGBA(r image.Rectangle) *image.RGBA {
+	m := image.NewRGBA(r)
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	// 乗算済みなので各色はアルファ以下にする
+	for i := 0; i < len(m.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if m.Pix[i+c] > m.Pix[i+3] {
+				m.Pix[i+c] = m.Pix[i+3]
+			}
+		}
+	}
+	return m
+}
+
+func randomNRGBA(r image.Rectangle) *image.NRGBA {
+	m := image.NewNRGBA(r)
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	return m
+}
+
+func randomRGBA64(r image.Rectangle) *image.RGBA64 {
+	m := image.NewRGBA64(r)
+	rnd := rand.New(rand.NewSource(1))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := uint16(rnd.Intn(0x10000))
+			m.SetRGBA64(x, y, color.RGBA64{v, v / 2, v / 3, 0xffff})
+		}
+	}
+	return m
+}
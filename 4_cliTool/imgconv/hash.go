@@ -0,0 +1,178 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// Hash は画像の知覚ハッシュ。
+// 似た画像はビットの違い(ハミング距離)が小さくなる。
+type Hash uint64
+
+// String は16桁の16進数を返す。
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hash %q", text)
+	}
+	*h = Hash(v)
+	return nil
+}
+
+// Distance は a と b のハミング距離(0-64)を返す。
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// HashKind は知覚ハッシュの種類。
+type HashKind int
+
+const (
+	AHash HashKind = iota // 平均ハッシュ。速いが明るさの変化に弱い
+	DHash                 // 差分ハッシュ。隣の画素との明暗を比べる
+	PHash                 // DCTによるハッシュ。遅いが圧縮やリサイズに強い
+)
+
+var hashKindNames = [...]string{
+	AHash: "ahash",
+	DHash: "dhash",
+	PHash: "phash",
+}
+
+func (k HashKind) String() string {
+	if k < 0 || int(k) >= len(hashKindNames) {
+		return fmt.Sprintf("HashKind(%d)", int(k))
+	}
+	return hashKindNames[k]
+}
+
+// ParseHashKind は "ahash", "dhash", "phash" を解析する。
+func ParseHashKind(name string) (HashKind, error) {
+	for k, n := range hashKindNames {
+		if n == name {
+			return HashKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash %q", name)
+}
+
+// Hash は kind の知覚ハッシュを返す。
+func (img Img) Hash(kind HashKind) Hash {
+	switch kind {
+	case DHash:
+		return img.DHash()
+	case PHash:
+		return img.PHash()
+	}
+	return img.AHash()
+}
+
+// AHash は8×8に縮小した画像の各画素が平均より明るいかどうかを並べたハッシュを返す。
+func (img Img) AHash() Hash {
+	px := img.lumas(8, 8)
+	sum := 0
+	for _, v := range px {
+		sum += int(v)
+	}
+	mean := sum / len(px)
+
+	var h Hash
+	for i, v := range px {
+		if int(v) > mean {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// DHash は9×8に縮小した画像の各行で、右の画素より明るいかどうかを並べたハッシュを返す。
+func (img Img) DHash() Hash {
+	px := img.lumas(9, 8)
+	var h Hash
+	i := 0
+	for y := 0; y < 8; y++ {
+		row := px[y*9 : y*9+9]
+		for x := 0; x < 8; x++ {
+			if row[x] > row[x+1] {
+				h |= 1 << uint(i)
+			}
+			i++
+		}
+	}
+	return h
+}
+
+// PHash は32×32に縮小した画像をDCTで変換し、低周波の8×8の係数が
+// 中央値より大きいかどうかを並べたハッシュを返す。
+func (img Img) PHash() Hash {
+	const n = 32
+	px := img.lumas(n, n)
+
+	// 行、列の順に1次元のDCTをかける。使うのは低周波の8×8だけなので、そこだけ計算する
+	var rows [n][8]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for x := 0; x < n; x++ {
+				s += float64(px[y*n+x]) * dctCos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	var coef [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for y := 0; y < n; y++ {
+				s += rows[y][u] * dctCos[v][y]
+			}
+			coef[v*8+u] = s
+		}
+	}
+
+	// 直流成分は画像全体の明るさなので、中央値には含めない
+	sorted := make([]float64, 63)
+	copy(sorted, coef[1:])
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var h Hash
+	for i, c := range coef {
+		if c > median {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// dctCos[u][x] はPHashで使う32点のDCT-IIの係数。
+var dctCos = func() (c [8][32]float64) {
+	for u := range c {
+		for x := range c[u] {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+	return c
+}()
+
+// lumas は w×h に縮小した画像の輝度を行ごとに並べて返す。
+func (img Img) lumas(w, h int) []uint8 {
+	g := img.Resize(w, h, Bilinear).Gray().Image.(*image.Gray)
+	px := make([]uint8, 0, w*h)
+	for y := 0; y < h; y++ {
+		px = append(px, g.Pix[g.PixOffset(0, y):][:w]...)
+	}
+	return px
+}
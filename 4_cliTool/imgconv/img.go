@@ -0,0 +1,212 @@
+// Package imgconv はQ2の画像変換を行うパッケージ。
+//
+// 画像の読み込みと書き出し、グレースケールへの変換、
+// ディレクトリ以下の画像の一括変換ができる。
+//
+//	img, err := imgconv.LoadImage("jisoo.jpg")
+//	if err != nil {
+//		return err
+//	}
+//	gray := img.Gray()
+//	err = gray.Save("jisoo.png", nil)
+package imgconv
+
+import (
+	"errors"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Img は読み込んだ画像。
+type Img struct {
+	Image         image.Image // 画像
+	Path          string      // 画像のパス。Decodeで読み込んだ場合は空
+	Format        string      // 読み込んだときの画像形式
+	Height, Width int         // 画像の幅、高さ
+	Meta          *Metadata   // JPEGのEXIFの情報。なければnil
+}
+
+// DecodeOptions は読み込むときの設定。
+type DecodeOptions struct {
+	// EXIFの向き(Orientation)に合わせて回転しない
+	IgnoreOrientation bool
+}
+
+// LoadImage は path の画像を読み込む。
+// 画像形式は中身から判定する。
+// JPEGのEXIFに向きがあれば、それに合わせて回転する。
+// ファイルを開けない場合は*fs.PathErrorを、
+// 画像として読み込めない場合は*DecodeErrorを返す。
+func LoadImage(path string) (Img, error) {
+	return LoadImageWith(path, nil)
+}
+
+// LoadImageWith はLoadImageと同じだが、読み込むときの設定を指定できる。
+// opts がnilならデフォルトの設定を使う。
+func LoadImageWith(path string, opts *DecodeOptions) (Img, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Img{}, err
+	}
+	// 読み込み用なのでCloseのエラーは無視する
+	defer f.Close()
+
+	img, err := DecodeWith(f, opts)
+	if err != nil {
+		var de *DecodeError
+		if errors.As(err, &de) {
+			de.Path = path
+			if f, ferr := FormatOf(path); ferr == nil {
+				de.Format = f.Name
+			}
+		}
+		return Img{}, err
+	}
+	img.Path = path
+	return img, nil
+}
+
+// Decode は r から画像を読み込む。
+// 画像として読み込めない場合は*DecodeErrorを返す。
+func Decode(r io.Reader) (Img, error) {
+	return DecodeWith(r, nil)
+}
+
+// DecodeWith はDecodeと同じだが、読み込むときの設定を指定できる。
+// opts がnilならデフォルトの設定を使う。
+func DecodeWith(r io.Reader, opts *DecodeOptions) (Img, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+
+	meta, r := readMetadata(r)
+	src, format, err := image.Decode(r)
+	if err != nil {
+		return Img{}, &DecodeError{Err: err}
+	}
+	img := newImg(src, "", format)
+	img.Meta = meta
+	if !opts.IgnoreOrientation {
+		img = img.orient()
+	}
+	return img, nil
+}
+
+func newImg(src image.Image, path, format string) Img {
+	size := src.Bounds().Size()
+	return Img{
+		Image:  src,
+		Path:   path,
+		Format: format,
+		Height: size.Y,
+		Width:  size.X,
+	}
+}
+
+// with は画像だけを m に置き換えたImgを返す。
+// 変換のメソッドはこれを使って新しいImgを返すので、
+// img.Resize(800, 0, CatmullRom).Gray() のようにつなげて使える。
+func (img Img) with(m image.Image) Img {
+	out := newImg(m, img.Path, img.Format)
+	out.Meta = img.Meta
+	return out
+}
+
+// Save は path の拡張子の画像形式で書き出す。
+// opts がnilならデフォルトの設定を使う。
+// 同じディレクトリの一時ファイルに書き出してから名前を変えるので、
+// 途中で失敗しても path に書きかけの画像が残ることはない。
+// ファイルを作れない場合は*fs.PathErrorを、
+// 書き出しに失敗した場合は*EncodeErrorを返す。
+func (img Img) Save(path string, opts *EncodeOptions) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	if format.Encode == nil {
+		return &EncodeError{Path: path, Format: format.Name, Err: ErrUnsupported}
+	}
+	return writeFile(path, format.Name, func(w io.Writer) error {
+		return img.Encode(w, format, opts)
+	})
+}
+
+// writeFile は encode で書いた一時ファイルを path に名前を変えて置く。
+// encode が返した*EncodeErrorには path を入れる。
+func writeFile(path, format string, encode func(w io.Writer) error) (rerr error) {
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			// 失敗したときは一時ファイルを消す。Closeはすでに呼んだかもしれない
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err := encode(f); err != nil {
+		var ee *EncodeError
+		if errors.As(err, &ee) {
+			ee.Path = path
+		}
+		return err
+	}
+	// 書き込みはCloseで失敗することもある
+	if err := f.Close(); err != nil {
+		return &EncodeError{Path: path, Format: format, Err: err}
+	}
+	// 上書きする場合は元のファイルのパーミッションを保つ
+	if st, err := os.Stat(path); err == nil && st.Mode().IsRegular() {
+		if err := os.Chmod(f.Name(), st.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// createTemp は path と同じディレクトリに一時ファイルを作る。
+// os.CreateTempは0600で作るので、os.Createと同じく0666からumaskを除いたパーミッションで作る。
+func createTemp(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(tempName(path), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+var tempSeq uint32
+
+// tempName は path と同じディレクトリの、隠しファイルの一時的な名前を返す。
+func tempName(path string) string {
+	n := atomic.AddUint32(&tempSeq, 1)
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(uint64(n), 36)
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+suffix+".tmp")
+}
+
+// Encode は format の画像形式で w に書き出す。
+// opts がnilならデフォルトの設定を使う。
+// 失敗した場合は*EncodeErrorを返す。
+func (img Img) Encode(w io.Writer, format *Format, opts *EncodeOptions) error {
+	if format.Encode == nil {
+		return &EncodeError{Format: format.Name, Err: ErrUnsupported}
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	if opts.KeepMetadata {
+		w = metadataWriter(w, format.Name, img.Meta)
+	}
+	if err := format.Encode(w, img.Image, opts); err != nil {
+		return &EncodeError{Format: format.Name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package imgconv
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+// 変換の戻り値にそのままSaveを呼べる。
+func TestSaveChain(t *testing.T) {
+	img := newImg(randomRGBA(image.Rect(0, 0, 40, 30)), "", "")
+	path := filepath.Join(t.TempDir(), "x.png")
+	if err := img.Resize(10, 0, Bilinear).Gray().Save(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(0, 0, 10, 8); got.Image.Bounds() != want {
+		t.Errorf("Bounds() = %v, want %v", got.Image.Bounds(), want)
+	}
+}
@@ -0,0 +1,137 @@
+package imgconv
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// Info は画像の全体を読み込まずにわかる情報。
+type Info struct {
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	ColorModel string `json:"color_model"`
+}
+
+// LoadInfo は path の画像の形式、大きさ、色のモデルをimage.DecodeConfigで調べる。
+// 画素は読み込まないので、大きな画像でも速い。
+// 大きさはEXIFの向きに合わせて回転する前のもの。
+// ファイルを開けない場合は*fs.PathErrorを、
+// 画像として読み込めない場合は*DecodeErrorを返す。
+func LoadInfo(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// 読み込み用なのでCloseのエラーは無視する
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		de := &DecodeError{Path: path, Err: err}
+		if f, ferr := FormatOf(path); ferr == nil {
+			de.Format = f.Name
+		}
+		return nil, de
+	}
+	return &Info{
+		Path:       path,
+		Format:     format,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		ColorModel: modelName(cfg.ColorModel),
+	}, nil
+}
+
+// modelName は標準の色のモデルの名前を返す。
+func modelName(m color.Model) string {
+	if p, ok := m.(color.Palette); ok {
+		// GIFはフレームごとのパレットしかないこともある
+		if len(p) == 0 {
+			return "Paletted"
+		}
+		return fmt.Sprintf("Paletted (%d colors)", len(p))
+	}
+	switch m {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.AlphaModel:
+		return "Alpha"
+	case color.Alpha16Model:
+		return "Alpha16"
+	case color.GrayModel:
+		return "Gray"
+	case color.Gray16Model:
+		return "Gray16"
+	case color.YCbCrModel:
+		return "YCbCr"
+	case color.NYCbCrAModel:
+		return "NYCbCrA"
+	case color.CMYKModel:
+		return "CMYK"
+	}
+	return fmt.Sprintf("%T", m)
+}
+
+// Histogram はチャンネルごとの値の数と輝度の統計。
+// RGBは乗算済みでない値を数える。
+type Histogram struct {
+	R    [256]int `json:"r"`
+	G    [256]int `json:"g"`
+	B    [256]int `json:"b"`
+	A    [256]int `json:"a"`
+	Luma [256]int `json:"luma"`
+
+	MeanLuma float64 `json:"mean_luma"`
+	MinLuma  uint8   `json:"min_luma"`
+	MaxLuma  uint8   `json:"max_luma"`
+}
+
+// Histogram は全ての画素を数えたヒストグラムを返す。
+// 空の画像ならエラーを返す。
+func (img Img) Histogram() (*Histogram, error) {
+	src := toRGBA(img.Image)
+	b := src.Bounds()
+	if b.Empty() {
+		return nil, errors.New("imgconv: empty image")
+	}
+
+	h := &Histogram{MinLuma: 0xff}
+	sum := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, y):][:b.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			c := color.RGBA{row[i], row[i+1], row[i+2], row[i+3]}
+			h.A[c.A]++
+			if c.A != 0xff {
+				n := color.NRGBAModel.Convert(c).(color.NRGBA)
+				c.R, c.G, c.B = n.R, n.G, n.B
+			}
+			h.R[c.R]++
+			h.G[c.G]++
+			h.B[c.B]++
+
+			l := luma(uint32(c.R)*0x101, uint32(c.G)*0x101, uint32(c.B)*0x101)
+			h.Luma[l]++
+			sum += int(l)
+			if l < h.MinLuma {
+				h.MinLuma = l
+			}
+			if l > h.MaxLuma {
+				h.MaxLuma = l
+			}
+		}
+	}
+	h.MeanLuma = float64(sum) / float64(b.Dx()*b.Dy())
+	return h, nil
+}
@@ -0,0 +1,144 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Op は画像の変換。ParseOpsで文字列から作れる。
+type Op func(Img) Img
+
+// Apply は ops を順に適用した画像を返す。
+func (img Img) Apply(ops ...Op) Img {
+	for _, op := range ops {
+		img = op(img)
+	}
+	return img
+}
+
+// ParseOps は "resize=800x0,gray,rotate=90" のようにカンマで区切った変換の並びを解析する。
+//
+//	gray                 グレースケール
+//	resize=WxH[:algo]    拡大縮小。0は縦横比を保つ。algoはnearest, bilinear, catmullrom
+//	crop=WxH[+X+Y]       左上(X, Y)から幅W、高さHを切り出す
+//	rotate=90|180|270    時計回りに回転
+//	fliph, flipv         左右、上下の反転
+//	blur=sigma           ガウスぼかし
+//	sharpen              輪郭の強調
+func ParseOps(s string) ([]Op, error) {
+	var ops []Op
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		op, err := parseOp(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid op %q: %w", spec, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func parseOp(spec string) (Op, error) {
+	name, arg, _ := strings.Cut(spec, "=")
+	switch name {
+	case "gray":
+		return Img.Gray, nil
+	case "fliph":
+		return Img.FlipH, nil
+	case "flipv":
+		return Img.FlipV, nil
+	case "sharpen":
+		return Img.Sharpen, nil
+	case "resize":
+		return parseResize(arg)
+	case "crop":
+		return parseCrop(arg)
+	case "rotate":
+		switch arg {
+		case "90":
+			return Img.Rotate90, nil
+		case "180":
+			return Img.Rotate180, nil
+		case "270":
+			return Img.Rotate270, nil
+		}
+		return nil, fmt.Errorf("angle must be 90, 180 or 270")
+	case "blur":
+		sigma, err := strconv.ParseFloat(arg, 64)
+		if err != nil || sigma <= 0 {
+			return nil, fmt.Errorf("sigma must be a positive number")
+		}
+		return func(img Img) Img { return img.GaussianBlur(sigma) }, nil
+	}
+	return nil, fmt.Errorf("unknown op")
+}
+
+// parseResize は "800x0" または "800x600:bilinear" を解析する。
+func parseResize(arg string) (Op, error) {
+	size, name, found := strings.Cut(arg, ":")
+	algo := CatmullRom
+	if found {
+		var err error
+		if algo, err = ParseInterpolation(name); err != nil {
+			return nil, err
+		}
+	}
+	w, h, err := parseSize(size)
+	if err != nil {
+		return nil, err
+	}
+	if w == 0 && h == 0 {
+		return nil, fmt.Errorf("width or height must be set")
+	}
+	return func(img Img) Img { return img.Resize(w, h, algo) }, nil
+}
+
+// parseCrop は "100x50+10+20" を解析する。
+func parseCrop(arg string) (Op, error) {
+	size, offset, _ := strings.Cut(arg, "+")
+	w, h, err := parseSize(size)
+	if err != nil {
+		return nil, err
+	}
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("width and height must be set")
+	}
+	var x, y int
+	if offset != "" {
+		xs, ys, found := strings.Cut(offset, "+")
+		if !found {
+			return nil, fmt.Errorf("offset must be +X+Y")
+		}
+		if x, err = strconv.Atoi(xs); err != nil {
+			return nil, err
+		}
+		if y, err = strconv.Atoi(ys); err != nil {
+			return nil, err
+		}
+	}
+	r := image.Rect(x, y, x+w, y+h)
+	return func(img Img) Img { return img.Crop(r) }, nil
+}
+
+// parseSize は "WxH" を解析する。
+func parseSize(s string) (w, h int, err error) {
+	ws, hs, found := strings.Cut(s, "x")
+	if !found {
+		return 0, 0, fmt.Errorf("size must be WxH")
+	}
+	if w, err = strconv.Atoi(ws); err != nil {
+		return 0, 0, err
+	}
+	if h, err = strconv.Atoi(hs); err != nil {
+		return 0, 0, err
+	}
+	if w < 0 || h < 0 {
+		return 0, 0, fmt.Errorf("size must not be negative")
+	}
+	return w, h, nil
+}
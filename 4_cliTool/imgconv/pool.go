@@ -0,0 +1,40 @@
+package imgconv
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach は0から n-1 までの i について、jobs の数のgoroutineで fn を呼ぶ。
+// 各goroutineは fn を1つずつ呼ぶので、fn が画像を1枚読み込むなら
+// 同時にメモリにある画像はjobs枚までになる。jobs が1未満なら1にする。
+// ctx が終わると残りの i では fn を呼ばず、呼んだ分が終わるのを待って返す。
+func forEach(ctx context.Context, n, jobs int, fn func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case ch <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(ch)
+	wg.Wait()
+}
@@ -0,0 +1,52 @@
+package imgconv
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 同時に呼ばれる fn はjobsの数までで、全ての i で1度ずつ呼ばれる。
+func TestForEach(t *testing.T) {
+	const n, jobs = 50, 3
+	var running, peak int32
+	var mu sync.Mutex
+	calls := make([]int, n)
+	forEach(context.Background(), n, jobs, func(i int) {
+		r := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		mu.Lock()
+		calls[i]++
+		if r > peak {
+			peak = r
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+	})
+
+	if peak > jobs {
+		t.Errorf("%d calls ran at once, want at most %d", peak, jobs)
+	}
+	for i, c := range calls {
+		if c != 1 {
+			t.Errorf("fn(%d) called %d times, want 1", i, c)
+		}
+	}
+}
+
+// ctx が終わった後は新しく fn を呼ばない。
+func TestForEachCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	forEach(ctx, 100, 1, func(i int) {
+		if atomic.AddInt32(&calls, 1) == 5 {
+			cancel()
+		}
+	})
+	// キャンセルしたときに受け渡し中だった1つは呼ばれることがある
+	if calls > 6 {
+		t.Errorf("fn called %d times after cancel, want at most 6", calls)
+	}
+}
@@ -0,0 +1,454 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"sort"
+)
+
+// Quantizer はパレットの作り方。
+type Quantizer int
+
+const (
+	MedianCut Quantizer = iota // メディアンカット。色の多い範囲を細かく分ける
+	Octree                     // オクトツリー。少ない色を先にまとめる
+	Plan9                      // palette.Plan9の256色。色の数は無視する
+	WebSafe                    // palette.WebSafeの216色。色の数は無視する
+)
+
+var quantizerNames = [...]string{
+	MedianCut: "mediancut",
+	Octree:    "octree",
+	Plan9:     "plan9",
+	WebSafe:   "websafe",
+}
+
+func (q Quantizer) String() string {
+	if q < 0 || int(q) >= len(quantizerNames) {
+		return fmt.Sprintf("Quantizer(%d)", int(q))
+	}
+	return quantizerNames[q]
+}
+
+// ParseQuantizer は "mediancut", "octree", "plan9", "websafe" を解析する。
+func ParseQuantizer(name string) (Quantizer, error) {
+	for q, n := range quantizerNames {
+		if n == name {
+			return Quantizer(q), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown quantizer %q", name)
+}
+
+// Dither は減色するときのディザリングの方法。
+type Dither int
+
+const (
+	NoDither       Dither = iota // 一番近い色にする
+	FloydSteinberg               // 誤差拡散。写真向き
+	Ordered                      // 8×8のBayer行列による組織的ディザ。模様が規則的になる
+)
+
+var ditherNames = [...]string{
+	NoDither:       "none",
+	FloydSteinberg: "fs",
+	Ordered:        "ordered",
+}
+
+func (d Dither) String() string {
+	if d < 0 || int(d) >= len(ditherNames) {
+		return fmt.Sprintf("Dither(%d)", int(d))
+	}
+	return ditherNames[d]
+}
+
+// ParseDither は "none", "fs", "ordered" を解析する。
+func ParseDither(name string) (Dither, error) {
+	for d, n := range ditherNames {
+		if n == name {
+			return Dither(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dither %q", name)
+}
+
+// Quantization は減色の設定。
+type Quantization struct {
+	Colors int // 色の数 (2-256)。透明な画素があれば透明の1色を含む
+	Method Quantizer
+	Dither Dither
+}
+
+// Quantize は q の設定で減色したパレット画像を返す。
+// GIFやPNGで書き出すと、このパレットがそのまま使われる。
+// GIFには半透明がないので、半分以上透明な画素は透明にし、それ以外は不透明にする。
+func (img Img) Quantize(q Quantization) Img {
+	src := toRGBA(img.Image)
+	transparent := hasTransparent(src)
+
+	n := q.Colors
+	if transparent {
+		n--
+	}
+	var pal color.Palette
+	switch q.Method {
+	case Plan9:
+		pal = palette.Plan9
+	case WebSafe:
+		pal = palette.WebSafe
+	default:
+		pal = img.Palette(n, q.Method)
+	}
+	if transparent {
+		// 透明を先頭に置き、固定のパレットなら最後の1色を削る
+		if len(pal) > 255 {
+			pal = pal[:255]
+		}
+		pal = append(color.Palette{color.RGBA{}}, pal...)
+	}
+
+	b := src.Bounds()
+	dst := image.NewPaletted(b, pal)
+	switch q.Dither {
+	case FloydSteinberg:
+		draw.FloydSteinberg.Draw(dst, b, src, b.Min)
+	case Ordered:
+		ditherOrdered(dst, src, len(pal))
+	default:
+		draw.Draw(dst, b, src, b.Min, draw.Src)
+	}
+	if transparent {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if src.RGBAAt(x, y).A < 0x80 {
+					dst.SetColorIndex(x, y, 0)
+				}
+			}
+		}
+	}
+	return img.with(dst)
+}
+
+// Palette は画像の色を n 色(最大256色)にまとめたパレットを返す。
+// 半分以上透明な画素は数えない。
+// 画像の色が n 色より少なければ、パレットも少なくなる。
+func (img Img) Palette(n int, q Quantizer) color.Palette {
+	if n > 256 {
+		n = 256
+	}
+	if n < 1 {
+		n = 1
+	}
+	bins := histogram(toRGBA(img.Image))
+	switch q {
+	case Plan9:
+		return palette.Plan9
+	case WebSafe:
+		return palette.WebSafe
+	case Octree:
+		return octreePalette(bins, n)
+	}
+	return medianCut(bins, n)
+}
+
+// bin は各チャンネルを上位5ビットにまとめた色の数と、元の色の合計。
+type bin struct {
+	c   [3]uint8 // 5ビットにした R, G, B
+	n   int
+	sum [3]int
+}
+
+func (b *bin) color() color.Color {
+	return color.RGBA{
+		R: uint8(b.sum[0] / b.n),
+		G: uint8(b.sum[1] / b.n),
+		B: uint8(b.sum[2] / b.n),
+		A: 0xff,
+	}
+}
+
+// histogram は32×32×32の箱ごとに画素を数える。
+// 全ての色を数えるより速く、メモリも一定で済む。
+func histogram(m *image.RGBA) []*bin {
+	var boxes [1 << 15]*bin
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := m.RGBAAt(x, y)
+			if c.A < 0x80 {
+				continue
+			}
+			c = opaqueOrClear(c)
+			i := int(c.R>>3)<<10 | int(c.G>>3)<<5 | int(c.B>>3)
+			if boxes[i] == nil {
+				boxes[i] = &bin{c: [3]uint8{c.R >> 3, c.G >> 3, c.B >> 3}}
+			}
+			boxes[i].n++
+			boxes[i].sum[0] += int(c.R)
+			boxes[i].sum[1] += int(c.G)
+			boxes[i].sum[2] += int(c.B)
+		}
+	}
+
+	var bins []*bin
+	for _, b := range boxes {
+		if b != nil {
+			bins = append(bins, b)
+		}
+	}
+	return bins
+}
+
+// medianCut は色の範囲が広くて画素の多い箱から順に、画素の数が半分になるところで分ける。
+func medianCut(bins []*bin, n int) color.Palette {
+	if len(bins) == 0 {
+		return color.Palette{color.Black}
+	}
+	boxes := [][]*bin{bins}
+	for len(boxes) < n {
+		best, bestScore, axis := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			a, width := widestAxis(box)
+			score := width * pixels(box)
+			if score > bestScore {
+				best, bestScore, axis = i, score, a
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return box[i].c[axis] < box[j].c[axis] })
+		half, count, cut := pixels(box)/2, 0, 1
+		for i, b := range box[:len(box)-1] {
+			count += b.n
+			cut = i + 1
+			if count >= half {
+				break
+			}
+		}
+		boxes[best] = box[:cut]
+		boxes = append(boxes, box[cut:])
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		sum := bin{}
+		for _, b := range box {
+			sum.n += b.n
+			for c := range sum.sum {
+				sum.sum[c] += b.sum[c]
+			}
+		}
+		pal[i] = sum.color()
+	}
+	return pal
+}
+
+// widestAxis は箱の中で色の範囲が一番広いチャンネルとその幅を返す。
+func widestAxis(box []*bin) (axis, width int) {
+	for a := 0; a < 3; a++ {
+		lo, hi := box[0].c[a], box[0].c[a]
+		for _, b := range box[1:] {
+			if b.c[a] < lo {
+				lo = b.c[a]
+			}
+			if b.c[a] > hi {
+				hi = b.c[a]
+			}
+		}
+		if w := int(hi-lo) + 1; w > width {
+			axis, width = a, w
+		}
+	}
+	return axis, width
+}
+
+func pixels(box []*bin) int {
+	n := 0
+	for _, b := range box {
+		n += b.n
+	}
+	return n
+}
+
+// octNode はオクトツリーの節。葉はまとめた色の合計を持つ。
+type octNode struct {
+	children [8]*octNode
+	sum      bin
+	leaf     bool
+}
+
+// octreePalette は5ビットの色をオクトツリーに入れ、葉が n 個になるまで
+// 深い節のうち画素の少ないものから子をまとめる。
+// 最後は子の一部だけをまとめて、色の数がちょうど n になるようにする。
+func octreePalette(bins []*bin, n int) color.Palette {
+	const depth = 5
+	root := &octNode{}
+	var levels [depth][]*octNode // 子を持つ節。深さごと
+	leaves := 0
+	for _, b := range bins {
+		node := root
+		for level := 0; level < depth; level++ {
+			shift := depth - 1 - level
+			i := (b.c[0]>>shift&1)<<2 | (b.c[1]>>shift&1)<<1 | b.c[2]>>shift&1
+			if node.children[i] == nil {
+				node.children[i] = &octNode{}
+				if level == depth-1 {
+					node.children[i].leaf = true
+					leaves++
+				} else {
+					levels[level+1] = append(levels[level+1], node.children[i])
+				}
+			}
+			node = node.children[i]
+		}
+		node.sum.n += b.n
+		for c := range node.sum.sum {
+			node.sum.sum[c] += b.sum[c]
+		}
+	}
+	levels[0] = []*octNode{root}
+
+	for level := depth - 1; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		for _, node := range nodes {
+			node.sum = subtotal(node)
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].sum.n < nodes[j].sum.n })
+		// 深い節から順にまとめるので、ここでの子は全て葉になっている
+		for _, node := range nodes {
+			need := leaves - n
+			if need <= 0 {
+				break
+			}
+			var children []*octNode
+			for _, child := range node.children {
+				if child != nil {
+					children = append(children, child)
+				}
+			}
+			if len(children)-1 <= need {
+				node.children = [8]*octNode{}
+				node.leaf = true
+				leaves -= len(children) - 1
+				continue
+			}
+
+			// 全部まとめると n 色より少なくなるので、画素の少ない子から need+1 個だけまとめる
+			sort.SliceStable(children, func(i, j int) bool { return children[i].sum.n < children[j].sum.n })
+			merged := &octNode{leaf: true}
+			for _, child := range children[:need+1] {
+				merged.sum.n += child.sum.n
+				for c := range merged.sum.sum {
+					merged.sum.sum[c] += child.sum.sum[c]
+				}
+			}
+			node.children = [8]*octNode{merged}
+			for i, child := range children[need+1:] {
+				node.children[i+1] = child
+			}
+			leaves -= need
+		}
+	}
+
+	var pal color.Palette
+	var collect func(*octNode)
+	collect = func(node *octNode) {
+		if node.leaf {
+			if node.sum.n > 0 {
+				pal = append(pal, node.sum.color())
+			}
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	if len(pal) == 0 {
+		pal = color.Palette{color.Black}
+	}
+	return pal
+}
+
+// subtotal は node の下の葉の合計を返す。
+func subtotal(node *octNode) bin {
+	if node.leaf {
+		return node.sum
+	}
+	var sum bin
+	for _, child := range node.children {
+		if child == nil {
+			continue
+		}
+		s := subtotal(child)
+		sum.n += s.n
+		for c := range sum.sum {
+			sum.sum[c] += s.sum[c]
+		}
+	}
+	return sum
+}
+
+// bayer は8×8のBayer行列。
+var bayer = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// ditherOrdered は画素ごとにBayer行列のしきい値をずらしてから一番近い色にする。
+// ずらす幅は色の数から見積もった、パレットの色の間隔にする。
+func ditherOrdered(dst *image.Paletted, src *image.RGBA, colors int) {
+	spread := 256
+	for k := 1; k*k*k <= colors; k++ {
+		spread = 256 / k
+	}
+	cache := make(map[color.RGBA]uint8)
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			if c.A < 0x80 {
+				continue
+			}
+			c = opaqueOrClear(c)
+			d := (bayer[y&7][x&7]*2 - 63) * spread / 128
+			c = color.RGBA{clampByte(int(c.R)+d, 255), clampByte(int(c.G)+d, 255), clampByte(int(c.B)+d, 255), 0xff}
+			i, ok := cache[c]
+			if !ok {
+				i = uint8(dst.Palette.Index(c))
+				cache[c] = i
+			}
+			dst.SetColorIndex(x, y, i)
+		}
+	}
+}
+
+// hasTransparent は m に半分以上透明な画素があるかを返す。
+func hasTransparent(m *image.RGBA) bool {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if m.RGBAAt(x, y).A < 0x80 {
+				return true
+			}
+		}
+	}
+	return false
+}
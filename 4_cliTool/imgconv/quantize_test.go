@@ -0,0 +1,39 @@
+package imgconv
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// 画像に十分な色があれば、パレットはちょうど指定した色の数になる。
+func TestQuantizeColors(t *testing.T) {
+	img := newImg(randomNRGBA(image.Rect(0, 0, 64, 64)), "", "")
+	opaque := img.Image.(*image.NRGBA)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+
+	for _, method := range []Quantizer{MedianCut, Octree} {
+		for _, n := range []int{2, 3, 8, 64, 256} {
+			q := img.Quantize(Quantization{Colors: n, Method: method})
+			if got := len(q.Image.(*image.Paletted).Palette); got != n {
+				t.Errorf("%v: %d colors, want %d", method, got, n)
+			}
+		}
+	}
+}
+
+// 2色しかない画像では、多く指定しても2色になる。
+func TestQuantizeTwoTone(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 32; i++ {
+		m.Set(i%8, i/8, color.White)
+	}
+	for _, method := range []Quantizer{MedianCut, Octree} {
+		q := newImg(m, "", "").Quantize(Quantization{Colors: 8, Method: method})
+		if got := len(q.Image.(*image.Paletted).Palette); got != 2 {
+			t.Errorf("%v: %d colors, want 2", method, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Interpolation はResizeで使う補間方法。
+type Interpolation int
+
+const (
+	Nearest    Interpolation = iota // 最近傍補間。速いが粗い
+	Bilinear                        // バイリニア補間
+	CatmullRom                      // Catmull-Romスプライン。遅いがきれい
+)
+
+var interpolationNames = [...]string{
+	Nearest:    "nearest",
+	Bilinear:   "bilinear",
+	CatmullRom: "catmullrom",
+}
+
+func (i Interpolation) String() string {
+	if i < 0 || int(i) >= len(interpolationNames) {
+		return fmt.Sprintf("Interpolation(%d)", int(i))
+	}
+	return interpolationNames[i]
+}
+
+// ParseInterpolation は "nearest", "bilinear", "catmullrom" を解析する。
+func ParseInterpolation(name string) (Interpolation, error) {
+	for i, n := range interpolationNames {
+		if n == name {
+			return Interpolation(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown interpolation %q", name)
+}
+
+func (i Interpolation) scaler() xdraw.Scaler {
+	switch i {
+	case Nearest:
+		return xdraw.NearestNeighbor
+	case Bilinear:
+		return xdraw.BiLinear
+	}
+	return xdraw.CatmullRom
+}
+
+// Resize は幅 w、高さ h に拡大縮小した画像を返す。
+// どちらかが0なら縦横比を保つように決める。両方0なら元の画像を返す。
+func (img Img) Resize(w, h int, algo Interpolation) Img {
+	b := img.Image.Bounds()
+	switch {
+	case w == 0 && h == 0:
+		return img
+	case b.Empty():
+		return img.with(image.NewRGBA(image.Rect(0, 0, w, h)))
+	case w == 0:
+		w = (b.Dx()*h + b.Dy()/2) / b.Dy()
+	case h == 0:
+		h = (b.Dy()*w + b.Dx()/2) / b.Dx()
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	algo.scaler().Scale(dst, dst.Bounds(), img.Image, b, draw.Src, nil)
+	return img.with(dst)
+}
+
+// Crop は r の範囲を切り出した画像を返す。
+// r は画像の左上を(0, 0)とした座標で、画像からはみ出した部分は切り捨てる。
+func (img Img) Crop(r image.Rectangle) Img {
+	b := img.Image.Bounds()
+	r = r.Add(b.Min).Intersect(b)
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img.Image, r.Min, draw.Src)
+	return img.with(dst)
+}
+
+// Rotate90 は時計回りに90度回転した画像を返す。
+func (img Img) Rotate90() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copyPixel(dst, h-1-y, x, src, x, y)
+		}
+	}
+	return img.with(dst)
+}
+
+// Rotate180 は180度回転した画像を返す。
+func (img Img) Rotate180() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copyPixel(dst, w-1-x, h-1-y, src, x, y)
+		}
+	}
+	return img.with(dst)
+}
+
+// Rotate270 は時計回りに270度(反時計回りに90度)回転した画像を返す。
+func (img Img) Rotate270() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copyPixel(dst, y, w-1-x, src, x, y)
+		}
+	}
+	return img.with(dst)
+}
+
+// FlipH は左右を反転した画像を返す。
+func (img Img) FlipH() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copyPixel(dst, w-1-x, y, src, x, y)
+		}
+	}
+	return img.with(dst)
+}
+
+// FlipV は上下を反転した画像を返す。
+func (img Img) FlipV() Img {
+	src := toRGBA(img.Image)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		copy(dst.Pix[dst.PixOffset(0, h-1-y):][:w*4], src.Pix[src.PixOffset(0, y):][:w*4])
+	}
+	return img.with(dst)
+}
+
+// toRGBA は m を左上が(0, 0)の*image.RGBAにする。
+// すでにそうなっていればコピーせずにそのまま返す。
+func toRGBA(m image.Image) *image.RGBA {
+	if rgba, ok := m.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := m.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), m, b.Min, draw.Src)
+	return dst
+}
+
+// copyPixel は src の(sx, sy)の画素を dst の(dx, dy)にコピーする。
+// どちらも左上が(0, 0)である必要がある。
+func copyPixel(dst *image.RGBA, dx, dy int, src *image.RGBA, sx, sy int) {
+	copy(dst.Pix[dy*dst.Stride+dx*4:][:4], src.Pix[sy*src.Stride+sx*4:])
+}
@@ -3,15 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
-	"flag"
 	// "strings"
-	"bufio"
-	"path/filepath"
-
-	"image"
-	_ "image/jpeg"
-	"image/png"
-	"log"
 )
 
 // var msg = flag.String("msg", "デフォルト値", "説明")
@@ -282,36 +274,10 @@ func main() {
 			3: fuga
 			4: fugafuga
 	*/
-	// mycat()
-
-	fmt.Println("********************************")
-	const dir = "/Users/0g/myapp/go_lesson/4_cliTool/resource"
-	// フラグを受け取る
-	var qn bool
-	flag.BoolVar(&qn, "qn", false, "行番号付与")
-
-	flag.Parse()
-
-	// ファイル名を受け取る
-	var args []string = flag.Args()
-
-	// ファイルを出力
-	for idx, fn := range args{
-		filePath := filepath.Join(dir, fn)
-		rf, err := os.Open(filePath)
-		if err != nil {
-			fmt.Println(err)
-		}
-	
-		scanner := bufio.NewScanner(rf)
-		for scanner.Scan() {
-			if qn {
-				fmt.Printf("%v: ", idx)
-			}
-			fmt.Println(scanner.Text())
-		}
-	}
-	fmt.Println("********************************")
+	/*
+		実装は cat パッケージと cmd/mycat にある。
+		$ go run ./cmd/mycat resource/hoge.txt resource/fuga.txt
+	*/
 
 	fmt.Println("********************************")
 	/*
@@ -332,79 +298,14 @@ func main() {
 		方針
 			- image, image/jpegを使う
 	*/
-	img := LoadImage("./resource/jisoo.jpg")
-	gray := img.Gray()
-	gray.Save("./resource/jisoo4.png")
+	/*
+		実装は imgconv パッケージと cmd/imgconv にある。
+		$ go run ./cmd/imgconv resource
+	*/
 
 	fmt.Println("********************************")
 }
 
-type Img struct {
-	Image image.Image // 画像
-	Path string // 画像のパス
-	Height, Width int // 画像の幅、高さ
-}
-
-func LoadImage(path string) Img {
-	f, _ := os.Open(path)
-	defer f.Close()
-
-	src, _, err := image.Decode(f)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	size := src.Bounds().Size()
-	width, height := size.X, size.Y
-	fmt.Println(width)
-
-	return Img{
-		Image: src,
-		Path: path,
-		Height: height,
-		Width: width,
-	}
-}
-
-func (img *Img) Save(path string) {
-	f, err := os.Create(path)
-	if err != nil {
-		log.Println("Cannot create file:", err)
-	}
-	defer f.Close()
-
-	png.Encode(f, img.Image)
-}
-
-
-/*
-	image.Rectの戻り値 image.Rectangle
-	type Point struct {
-		x, y int
-	}
-	type Rectangle struct {
-		X, Y Point
-	}
-*/
-func (img *Img) Gray() Img {
-	canvas := image.NewGray(
-		image.Rect(0, 0, img.Width, img.Height), // (Pt(x0, y0), Pt(x1, y1))を指定する。
-	)
-
-	for y:=0; y<img.Height; y++ {
-		for x:=0; x<img.Width; x++ {
-			canvas.Set(x, y, img.Image.At(x, y))
-		}
-	}
-
-	return Img{
-		Image: canvas,
-		Path: img.Path,
-		Height: img.Height,
-		Width: img.Width,
-	}
-}
-
 func f() error {
 	return nil
 }
\ No newline at end of file